@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/query"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/trie"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+type span struct {
+	start int
+	end   int
+}
+
+// return the byte ranges of line that match term, compared to each word as per match.
+// term must already be folded, unless caseSensitive.
+func matchSpans(line string, term string, match trie.Match, caseSensitive bool) []span {
+	var result []span
+	termRunes := []rune(term)
+	if len(termRunes) == 0 {
+		return result
+	}
+
+	wordStart := -1
+	for idx, c := range line {
+		if trie.IsWordRune(c) {
+			if wordStart < 0 {
+				wordStart = idx
+			}
+		} else if wordStart >= 0 {
+			result = append(result, matchWordSpans(line[wordStart:idx], wordStart, termRunes, match, caseSensitive)...)
+			wordStart = -1
+		}
+	}
+	if wordStart >= 0 {
+		result = append(result, matchWordSpans(line[wordStart:], wordStart, termRunes, match, caseSensitive)...)
+	}
+
+	return result
+}
+
+// return the byte ranges of word, which starts at offset in its line, that match termRunes
+func matchWordSpans(word string, offset int, termRunes []rune, match trie.Match, caseSensitive bool) []span {
+	var wordRunes []rune
+	// byteOffsets[i] is where rune i of word starts, with a final entry for the end of word
+	var byteOffsets []int
+	for idx, c := range word {
+		if !caseSensitive {
+			c = trie.FoldRune(c)
+		}
+		wordRunes = append(wordRunes, c)
+		byteOffsets = append(byteOffsets, offset+idx)
+	}
+	byteOffsets = append(byteOffsets, offset+len(word))
+
+	runeSpan := func(start int) span {
+		return span{byteOffsets[start], byteOffsets[start+len(termRunes)]}
+	}
+
+	var result []span
+	switch match {
+	case trie.MatchWord:
+		if len(wordRunes) == len(termRunes) && runesAt(wordRunes, termRunes, 0) {
+			result = append(result, runeSpan(0))
+		}
+	case trie.MatchPrefix:
+		if runesAt(wordRunes, termRunes, 0) {
+			result = append(result, runeSpan(0))
+		}
+	case trie.MatchSuffix:
+		start := len(wordRunes) - len(termRunes)
+		if start >= 0 && runesAt(wordRunes, termRunes, start) {
+			result = append(result, runeSpan(start))
+		}
+	case trie.MatchInfix:
+		for start := 0; start+len(termRunes) <= len(wordRunes); start++ {
+			if runesAt(wordRunes, termRunes, start) {
+				result = append(result, runeSpan(start))
+				start += len(termRunes) - 1
+			}
+		}
+	}
+	return result
+}
+
+// return whether termRunes appear in wordRunes, from start
+func runesAt(wordRunes []rune, termRunes []rune, start int) bool {
+	if start+len(termRunes) > len(wordRunes) {
+		return false
+	}
+	for i, c := range termRunes {
+		if wordRunes[start+i] != c {
+			return false
+		}
+	}
+	return true
+}
+
+// return the byte ranges of line that match any of the terms or regular expressions matched by hit, in order and
+// without overlap
+func hitSpans(line string, hit query.Hit, caseSensitive bool) []span {
+	var spans []span
+	for _, matched := range hit.Matches {
+		spans = append(spans, termSpans(line, matched, caseSensitive)...)
+	}
+	for _, pattern := range hit.Patterns {
+		spans = append(spans, patternSpans(line, pattern)...)
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	var result []span
+	for _, s := range spans {
+		if len(result) > 0 && s.start <= result[len(result)-1].end {
+			if s.end > result[len(result)-1].end {
+				result[len(result)-1].end = s.end
+			}
+			continue
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// return the byte ranges of line that match the matched term, within the words the index has for it, at the columns the
+// index has them at. When the line does not have those words there, e.g. as the file changed since it was indexed, the
+// words of the line are compared to the term instead.
+func termSpans(line string, matched query.MatchedTerm, caseSensitive bool) []span {
+	if matched.TerminalNode == nil || !hasOccurrences(line, matched.TerminalNode.Occurrences) {
+		return scanTermSpans(line, matched, caseSensitive)
+	}
+
+	termRunes := []rune(foldTerm(matched.Term.Text, caseSensitive))
+	var result []span
+	for _, occurrence := range matched.TerminalNode.Occurrences {
+		start := int(occurrence.Column)
+		if matched.Term.Fuzzy > 0 {
+			// the word that matched is highlighted, rather than the term
+			result = append(result, span{start, start + len(occurrence.Word)})
+			continue
+		}
+		result = append(result, matchWordSpans(occurrence.Word, start, termRunes, matched.Term.Match, caseSensitive)...)
+	}
+	return result
+}
+
+// return whether line has the word of each occurrence at its column
+func hasOccurrences(line string, occurrences []trie.Occurrence) bool {
+	for _, occurrence := range occurrences {
+		start := int(occurrence.Column)
+		end := start + len(occurrence.Word)
+		if start < 0 || end > len(line) || line[start:end] != occurrence.Word {
+			return false
+		}
+	}
+	return true
+}
+
+// return the byte ranges of line that match the matched term, comparing the term to every word of line
+func scanTermSpans(line string, matched query.MatchedTerm, caseSensitive bool) []span {
+	if matched.Term.Fuzzy > 0 {
+		var result []span
+		if matched.TerminalNode != nil {
+			for _, occurrence := range matched.TerminalNode.Occurrences {
+				result = append(result, matchSpans(line, occurrence.Word, trie.MatchWord, true)...)
+			}
+		}
+		return result
+	}
+
+	return matchSpans(line, foldTerm(matched.Term.Text, caseSensitive), matched.Term.Match, caseSensitive)
+}
+
+func foldTerm(term string, caseSensitive bool) string {
+	if caseSensitive {
+		return term
+	}
+	return trie.Fold(term)
+}
+
+// return the byte ranges of line that pattern matches, leaving out empty matches
+func patternSpans(line string, pattern *regexp.Regexp) []span {
+	var result []span
+	for _, match := range pattern.FindAllStringIndex(line, -1) {
+		if match[1] > match[0] {
+			result = append(result, span{match[0], match[1]})
+		}
+	}
+	return result
+}
+
+// return line cut to at most limit bytes, without splitting a rune, and whether it had to be cut
+func capLine(line string, limit int) (string, bool) {
+	if len(line) <= limit {
+		return line, false
+	}
+	end := limit
+	for end > 0 && !utf8.RuneStart(line[end]) {
+		end--
+	}
+	return line[:end], true
+}
+
+func printHighlighted(line string, spans []span, style lipgloss.Style) {
+	at := 0
+	for _, s := range spans {
+		if s.start >= len(line) {
+			break
+		}
+		end := s.end
+		if end > len(line) {
+			end = len(line)
+		}
+		fmt.Print(line[at:s.start])
+		fmt.Print(style.Render(line[s.start:end]))
+		at = end
+	}
+	fmt.Print(line[at:])
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fileutil"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/query"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/trie"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"regexp"
+	"testing"
+)
+
+func TestMatchSpansCyrillic(t *testing.T) {
+	lines, err := fileutil.GetLinesFromFile("testdata/file_to_write_a_test_for.txt", 0, math.MaxInt32)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(lines))
+
+	term := trie.Fold("ПОДАВАНИЯ")
+	spans := matchSpans(lines[1], term, trie.MatchWord, false)
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, "подавания", lines[1][spans[0].start:spans[0].end])
+
+	// a prefix search only highlights the matching part of each word
+	spans = matchSpans(lines[1], trie.Fold("Подава"), trie.MatchPrefix, false)
+	assert.Equal(t, 2, len(spans))
+	assert.Equal(t, "подава", lines[1][spans[0].start:spans[0].end])
+	assert.Equal(t, "подава", lines[1][spans[1].start:spans[1].end])
+}
+
+func TestMatchSpansWholeWord(t *testing.T) {
+	spans := matchSpans("Config config configured", "config", trie.MatchWord, false)
+	assert.Equal(t, []span{{0, 6}, {7, 13}}, spans)
+
+	spans = matchSpans("Config config configured", "config", trie.MatchPrefix, false)
+	assert.Equal(t, []span{{0, 6}, {7, 13}, {14, 20}}, spans)
+}
+
+func TestMatchSpansCaseSensitive(t *testing.T) {
+	spans := matchSpans("Config config configured", "Config", trie.MatchWord, true)
+	assert.Equal(t, []span{{0, 6}}, spans)
+
+	spans = matchSpans("Config config configured", "conf", trie.MatchPrefix, true)
+	assert.Equal(t, []span{{7, 11}, {14, 18}}, spans)
+}
+
+func TestCapLine(t *testing.T) {
+	capped, wasCapped := capLine("пробите", 5)
+	assert.True(t, wasCapped)
+	assert.Equal(t, "пр", capped)
+
+	capped, wasCapped = capLine("short", 5)
+	assert.False(t, wasCapped)
+	assert.Equal(t, "short", capped)
+}
+
+func TestMatchSpansSuffixAndInfix(t *testing.T) {
+	spans := matchSpans("requestHandler handlers", "handler", trie.MatchSuffix, false)
+	assert.Equal(t, []span{{7, 14}}, spans)
+
+	spans = matchSpans("lruCache cachecache", "cache", trie.MatchInfix, false)
+	assert.Equal(t, []span{{3, 8}, {9, 14}, {14, 19}}, spans)
+
+	// byte offsets stay correct after multi byte runes
+	spans = matchSpans("пробите", "бит", trie.MatchInfix, false)
+	assert.Equal(t, []span{{6, 12}}, spans)
+}
+
+func TestHitSpansRegexAndTerm(t *testing.T) {
+	hit := query.Hit{
+		Matches:  []query.MatchedTerm{{Term: query.Term{Text: "retry", Match: trie.MatchWord}}},
+		Patterns: []*regexp.Regexp{regexp.MustCompile(`\d+ ?ms`), regexp.MustCompile(`x*`)},
+	}
+
+	// empty matches of a regular expression are not highlighted
+	spans := hitSpans("retry after 250 ms, Retry 5ms", hit, false)
+	assert.Equal(t, []span{{0, 5}, {12, 18}, {20, 25}, {26, 29}}, spans)
+}
+
+func TestHitSpansFuzzy(t *testing.T) {
+	terminalNode := &trie.TerminalNode{Occurrences: []trie.Occurrence{{Word: "Receive", Position: 1, Column: 7}}}
+	hit := query.Hit{
+		Matches: []query.MatchedTerm{{Term: query.Term{Text: "recieve", Fuzzy: 2}, TerminalNode: terminalNode, Distance: 2}},
+	}
+
+	// the word that matched is highlighted, not the term
+	spans := hitSpans("please Receive recieve", hit, false)
+	assert.Equal(t, []span{{7, 14}}, spans)
+}
+
+func TestTermSpansAtIndexedColumns(t *testing.T) {
+	terminalNode := &trie.TerminalNode{Occurrences: []trie.Occurrence{{Word: "configured", Position: 2, Column: 14}}}
+	matched := query.MatchedTerm{Term: query.Term{Text: "conf", Match: trie.MatchPrefix}, TerminalNode: terminalNode}
+
+	// only the word of the terminal node is highlighted, not every word the term matches
+	spans := termSpans("Config config configured", matched, false)
+	assert.Equal(t, []span{{14, 18}}, spans)
+
+	// the line changed since it was indexed, so its words are compared to the term
+	spans = termSpans("configured Config", matched, false)
+	assert.Equal(t, []span{{0, 4}, {11, 15}}, spans)
+}
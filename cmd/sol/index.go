@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/trie"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// the index for a root lives under ~/.sol/index, named after a hash of the absolute root path
+func indexFilePath(solDirPath string, root string) string {
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(solDirPath, "index", hex.EncodeToString(sum[:16])+".idx")
+}
+
+// return the trie stored at indexPath, or nil if there is no usable index. Progress is written to progress.
+func loadTrie(indexPath string, root string, minWordLength int32, progress io.Writer) *trie.Trie {
+	loadedTrie, err := trie.LoadFile(indexPath, root, minWordLength)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(progress, "Rebuilding index, could not use %v: %v\n", indexPath, err.Error())
+		}
+		return nil
+	}
+	fmt.Fprintf(progress, "Loaded index from %v\n", indexPath)
+	return loadedTrie
+}
+
+// return loadedTrie brought up to date with filesToScan, or if there is no loaded trie, a newly built one.
+// Either way, the result is stored at indexPath. Progress is written to progress.
+func syncOrBuildTrie(loadedTrie *trie.Trie, indexPath string, root string, minWordLength int32, filesToScan []fullfileinfo.Full, workers int, progress io.Writer) *trie.Trie {
+	if loadedTrie != nil {
+		added, changed, removed := loadedTrie.Sync(filesToScan, workers)
+		if added+changed+removed > 0 {
+			fmt.Fprintf(progress, "Updated index, files added: %v, changed: %v, removed: %v\n", added, changed, removed)
+			saveTrie(loadedTrie, indexPath, root, progress)
+		}
+		return loadedTrie
+	}
+
+	newTrie := trie.NewTrie(minWordLength)
+	newTrie.AddAll(filesToScan, workers)
+	saveTrie(newTrie, indexPath, root, progress)
+
+	return newTrie
+}
+
+func saveTrie(toSave *trie.Trie, indexPath string, root string, progress io.Writer) {
+	if err := toSave.SaveFile(indexPath, root); err != nil {
+		fmt.Fprintf(progress, "Could not save index to %v: %v\n", indexPath, err.Error())
+	}
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fileutil"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/trie"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the most symbols answered to a workspace/symbol request, editors ask again as the query is typed
+const maxSymbols = 500
+
+// JSON-RPC and LSP error codes
+const (
+	rpcParseError           = -32700
+	rpcInvalidParams        = -32602
+	rpcMethodNotFound       = -32601
+	rpcServerNotInitialized = -32002
+)
+
+// the kind all symbols are answered with; the index has words, not what they are declared as
+const symbolKindVariable = 13
+
+type lspArgs struct {
+	// the root to index, when not taken from the editor's initialize request
+	pathToScan    string
+	watch         bool
+	caseSensitive bool
+	indexArgs
+}
+
+// parseLspArgs parses the args of: sol lsp [pathToScan], with the startup flags
+func parseLspArgs(args []string) (lspArgs, error) {
+	result := lspArgs{
+		indexArgs: newIndexArgs(),
+	}
+
+	for idx := 0; idx < len(args); idx++ {
+		arg := args[idx]
+		if taken, err := result.indexArgs.parse(args, idx); err != nil {
+			return result, err
+		} else if taken > 0 {
+			idx += taken - 1
+		} else if arg == "-W" {
+			result.watch = true
+		} else if arg == "-C" {
+			result.caseSensitive = true
+		} else if arg != "" && arg[0:1] != "-" && result.pathToScan == "" {
+			result.pathToScan = arg
+		} else {
+			return result, errors.New(fmt.Sprintf("unexpected arg %s", arg))
+		}
+	}
+
+	return result, nil
+}
+
+// lsp speaks the language server protocol over stdin and stdout, until the editor asks it to exit
+func lsp(args []string) int {
+	parsed, err := parseLspArgs(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: "+err.Error())
+		return exitError
+	}
+
+	// stdout carries the protocol, anything else printed while indexing or watching would break it
+	protocolOut := os.Stdout
+	os.Stdout = os.Stderr
+
+	return newLspServer(parsed, os.Stdin, protocolOut, os.Stderr).run()
+}
+
+// lspServer answers initialize, workspace/symbol, and sol/search requests against the index of the workspace
+type lspServer struct {
+	args     lspArgs
+	reader   *bufio.Reader
+	writer   io.Writer
+	progress io.Writer
+
+	opened   *openedIndex
+	shutdown bool
+	// whether the characters of positions are counted in runes, as the editor offered to, rather than in the utf-16 units
+	// the protocol counts them in otherwise
+	utf32 bool
+}
+
+func newLspServer(args lspArgs, in io.Reader, out io.Writer, progress io.Writer) *lspServer {
+	return &lspServer{
+		args:     args,
+		reader:   bufio.NewReader(in),
+		writer:   out,
+		progress: progress,
+	}
+}
+
+type rpcMessage struct {
+	Id     *json.RawMessage `json:"id,omitempty"`
+	Method string           `json:"method,omitempty"`
+	Params json.RawMessage  `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JsonRpc string           `json:"jsonrpc"`
+	Id      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+}
+
+// an error response has no result, not even null
+type rpcErrorResponse struct {
+	JsonRpc string           `json:"jsonrpc"`
+	Id      *json.RawMessage `json:"id"`
+	Error   *rpcError        `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// run answers messages until the exit notification, or the end of the input, and returns the exit code: 0 when shutdown
+// was requested first, otherwise 1, as the protocol asks
+func (s *lspServer) run() int {
+	for {
+		message, err := s.readMessage()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				s.writeMessage(rpcErrorResponse{JsonRpc: "2.0", Error: &rpcError{rpcParseError, err.Error()}})
+				continue
+			}
+			fmt.Fprintf(s.progress, "Error: %v\n", err.Error())
+			break
+		}
+
+		if message.Method == "exit" {
+			break
+		}
+		result, rpcErr := s.handle(message)
+		if message.Id == nil {
+			// a notification, which has no response
+			continue
+		}
+		if rpcErr != nil {
+			s.writeMessage(rpcErrorResponse{JsonRpc: "2.0", Id: message.Id, Error: rpcErr})
+		} else {
+			s.writeMessage(rpcResponse{JsonRpc: "2.0", Id: message.Id, Result: result})
+		}
+	}
+
+	if s.shutdown {
+		return 0
+	}
+	return 1
+}
+
+func (s *lspServer) handle(message rpcMessage) (interface{}, *rpcError) {
+	if message.Method == "initialize" {
+		return s.initialize(message.Params)
+	}
+	if s.opened == nil {
+		if message.Id == nil {
+			return nil, nil
+		}
+		return nil, &rpcError{rpcServerNotInitialized, "expected initialize first"}
+	}
+
+	switch message.Method {
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "workspace/symbol":
+		return s.workspaceSymbol(message.Params)
+	case "sol/search":
+		return s.search(message.Params)
+	}
+
+	if message.Id == nil || strings.HasPrefix(message.Method, "$/") {
+		// notifications, and requests starting with $/, may be ignored
+		return nil, nil
+	}
+	return nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("unsupported method %v", message.Method)}
+}
+
+type initializeParams struct {
+	RootUri          string `json:"rootUri"`
+	RootPath         string `json:"rootPath"`
+	WorkspaceFolders []struct {
+		Uri string `json:"uri"`
+	} `json:"workspaceFolders"`
+	Capabilities struct {
+		General struct {
+			PositionEncodings []string `json:"positionEncodings"`
+		} `json:"general"`
+	} `json:"capabilities"`
+}
+
+// index the root given on the command line, or else the one of the editor's workspace
+func (s *lspServer) initialize(params json.RawMessage) (interface{}, *rpcError) {
+	var initialize initializeParams
+	if err := json.Unmarshal(params, &initialize); err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+
+	root := s.args.pathToScan
+	if root == "" && initialize.RootUri != "" {
+		root = uriToPath(initialize.RootUri)
+	}
+	if root == "" && len(initialize.WorkspaceFolders) > 0 {
+		root = uriToPath(initialize.WorkspaceFolders[0].Uri)
+	}
+	if root == "" {
+		root = initialize.RootPath
+	}
+	if root == "" {
+		return nil, &rpcError{rpcInvalidParams, "expected a rootUri, or a pathToScan on the command line"}
+	}
+
+	opened, err := openIndex(root, s.args.indexArgs, s.progress)
+	if err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+	if s.args.watch {
+		watchForChanges(opened.trie, opened.filter)
+	}
+	s.opened = &opened
+
+	capabilities := map[string]interface{}{
+		"workspaceSymbolProvider": true,
+	}
+	for _, encoding := range initialize.Capabilities.General.PositionEncodings {
+		if encoding == "utf-32" {
+			// the index has rune columns, which need no reading of the lines to answer with
+			s.utf32 = true
+			capabilities["positionEncoding"] = encoding
+		}
+	}
+
+	return map[string]interface{}{
+		"capabilities": capabilities,
+		"serverInfo":   map[string]string{"name": "sol"},
+	}, nil
+}
+
+type lspPosition struct {
+	Line      int32 `json:"line"`
+	Character int32 `json:"character"`
+}
+
+type lspLocation struct {
+	Uri   string `json:"uri"`
+	Range struct {
+		Start lspPosition `json:"start"`
+		End   lspPosition `json:"end"`
+	} `json:"range"`
+}
+
+type symbolInformation struct {
+	Name          string      `json:"name"`
+	Kind          int         `json:"kind"`
+	Location      lspLocation `json:"location"`
+	ContainerName string      `json:"containerName,omitempty"`
+}
+
+// answer with the occurrences of the words that equal the query, and then of those starting with it, in the order of
+// their paths and lines, until there are maxSymbols
+func (s *lspServer) workspaceSymbol(params json.RawMessage) (interface{}, *rpcError) {
+	var symbolParams struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(params, &symbolParams); err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+
+	result := make([]symbolInformation, 0)
+	if symbolParams.Query == "" {
+		// every word would match
+		return result, nil
+	}
+
+	// the symbols that are not all ascii before them on their line, which utf-16 may count differently from runes
+	var columns []symbolColumn
+collect:
+	for _, match := range []trie.Match{trie.MatchWord, trie.MatchPrefix} {
+		found, err := s.opened.trie.Find(symbolParams.Query, match, s.args.caseSensitive)
+		if err != nil {
+			// not a word, so no identifier can match
+			return result, nil
+		}
+		// a copy, as the terminal nodes of a word are those of the index
+		terminalNodes := append([]*trie.TerminalNode(nil), found...)
+		sort.SliceStable(terminalNodes, func(i, j int) bool {
+			if terminalNodes[i].FullPath() != terminalNodes[j].FullPath() {
+				return terminalNodes[i].FullPath() < terminalNodes[j].FullPath()
+			}
+			return terminalNodes[i].LineNumber < terminalNodes[j].LineNumber
+		})
+
+		for _, terminalNode := range terminalNodes {
+			for _, occurrence := range terminalNode.Occurrences {
+				if !occurrence.Matches(symbolParams.Query, match, s.args.caseSensitive) {
+					continue
+				}
+				if match == trie.MatchPrefix && occurrence.Matches(symbolParams.Query, trie.MatchWord, s.args.caseSensitive) {
+					// answered already
+					continue
+				}
+				if len(result) == maxSymbols {
+					break collect
+				}
+
+				symbol := symbolInformation{
+					Name:          occurrence.Word,
+					Kind:          symbolKindVariable,
+					ContainerName: s.relativePath(terminalNode.FullPath()),
+				}
+				symbol.Location.Uri = pathToUri(terminalNode.FullPath())
+				length := int32(len([]rune(occurrence.Word)))
+				if !s.utf32 {
+					length = utf16Length(occurrence.Word)
+					if occurrence.Column != occurrence.RuneColumn {
+						columns = append(columns, symbolColumn{len(result), terminalNode.FullPath(), terminalNode.LineNumber,
+							occurrence.Column})
+					}
+				}
+				symbol.Location.Range.Start = lspPosition{terminalNode.LineNumber - 1, occurrence.RuneColumn}
+				symbol.Location.Range.End = lspPosition{terminalNode.LineNumber - 1, occurrence.RuneColumn + length}
+				result = append(result, symbol)
+			}
+		}
+	}
+	utf16Columns(result, columns)
+
+	return result, nil
+}
+
+// symbolColumn is where the symbol at index of the answer is, in bytes from the start of its line
+type symbolColumn struct {
+	index      int
+	fullPath   string
+	lineNumber int32
+	column     int32
+}
+
+// count the characters of the symbols at columns from the start of their lines in utf-16 units, which takes reading
+// their lines. A symbol of a file that can not be read, or has changed since it was indexed, keeps its rune column.
+func utf16Columns(symbols []symbolInformation, columns []symbolColumn) {
+	byFile := make(map[string][]symbolColumn)
+	for _, column := range columns {
+		byFile[column.fullPath] = append(byFile[column.fullPath], column)
+	}
+
+	for fullPath, fileColumns := range byFile {
+		byLine := make(map[int32][]symbolColumn, len(fileColumns))
+		lastLine := int32(0)
+		for _, column := range fileColumns {
+			byLine[column.lineNumber] = append(byLine[column.lineNumber], column)
+			if column.lineNumber > lastLine {
+				lastLine = column.lineNumber
+			}
+		}
+
+		_ = fileutil.ScanLines(fullPath, func(lineNumber int32, line string) bool {
+			for _, column := range byLine[lineNumber] {
+				if int(column.column) > len(line) {
+					continue
+				}
+				symbolRange := &symbols[column.index].Location.Range
+				length := symbolRange.End.Character - symbolRange.Start.Character
+				symbolRange.Start.Character = utf16Length(line[:column.column])
+				symbolRange.End.Character = symbolRange.Start.Character + length
+			}
+			return lineNumber < lastLine
+		})
+	}
+}
+
+// return the number of utf-16 units of text, in which a rune outside the basic multilingual plane takes two
+func utf16Length(text string) int32 {
+	length := int32(0)
+	for _, r := range text {
+		length++
+		if r > 0xFFFF {
+			length++
+		}
+	}
+	return length
+}
+
+// answer a query, as sol search does, with the hits as with sol serve's /search
+func (s *lspServer) search(params json.RawMessage) (interface{}, *rpcError) {
+	searchParams := struct {
+		Query         string `json:"query"`
+		Before        int32  `json:"before"`
+		After         int32  `json:"after"`
+		Limit         int32  `json:"limit"`
+		CaseSensitive *bool  `json:"caseSensitive"`
+		PerFile       bool   `json:"perFile"`
+		PathOrder     bool   `json:"pathOrder"`
+	}{}
+	if err := json.Unmarshal(params, &searchParams); err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+	if searchParams.Query == "" {
+		return nil, &rpcError{rpcInvalidParams, "expected a query"}
+	}
+	if searchParams.Before < 0 || searchParams.After < 0 || searchParams.Limit < 0 {
+		return nil, &rpcError{rpcInvalidParams, "expected before, after, and limit not to be negative"}
+	}
+
+	execution := executionArgs{
+		noPrefixArgs:  searchParams.Query,
+		before:        searchParams.Before,
+		after:         searchParams.After,
+		caseSensitive: s.args.caseSensitive,
+		perFile:       searchParams.PerFile,
+		pathOrder:     searchParams.PathOrder,
+		format:        formatJson,
+	}
+	if searchParams.CaseSensitive != nil {
+		execution.caseSensitive = *searchParams.CaseSensitive
+	}
+
+	response, err := searchIndex(*s.opened, execution, searchParams.Limit)
+	if err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+	return response, nil
+}
+
+func (s *lspServer) relativePath(fullPath string) string {
+	relativePath, err := filepath.Rel(s.opened.root, fullPath)
+	if err != nil {
+		return fullPath
+	}
+	return filepath.ToSlash(relativePath)
+}
+
+// read a message: headers, of which only Content-Length matters, an empty line, and then that many bytes of json
+func (s *lspServer) readMessage() (rpcMessage, error) {
+	var message rpcMessage
+
+	headers, err := textproto.NewReader(s.reader).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(headers) == 0 {
+			return message, io.EOF
+		}
+		return message, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return message, errors.New(fmt.Sprintf("invalid Content-Length %v", headers.Get("Content-Length")))
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, body); err != nil {
+		return message, err
+	}
+	err = json.Unmarshal(body, &message)
+	return message, err
+}
+
+func (s *lspServer) writeMessage(response interface{}) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		fmt.Fprintf(s.progress, "Error: %v\n", err.Error())
+		return
+	}
+	fmt.Fprintf(s.writer, "Content-Length: %v\r\n\r\n%s", len(body), body)
+}
+
+// return the path of a file:// uri, or "" for any other uri
+func uriToPath(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return ""
+	}
+	result := parsed.Path
+	if runtime.GOOS == "windows" {
+		// file:///C:/dir has the path /C:/dir
+		result = strings.TrimPrefix(result, "/")
+	}
+	return filepath.FromSlash(result)
+}
+
+func pathToUri(fullPath string) string {
+	slashed := filepath.ToSlash(fullPath)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String()
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseLspArgs(t *testing.T) {
+	parsed, err := parseLspArgs([]string{"-J", "2", "./src", "-C"})
+	assert.Nil(t, err)
+	assert.Equal(t, "./src", parsed.pathToScan)
+	assert.Equal(t, 2, parsed.workers)
+	assert.True(t, parsed.caseSensitive)
+
+	parsed, err = parseLspArgs([]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, "", parsed.pathToScan)
+
+	_, err = parseLspArgs([]string{"./src", "./other"})
+	assert.NotNil(t, err)
+}
+
+func TestLspServer(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("func retryConnection() {\n\tü := retry()\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var in bytes.Buffer
+	writeRequest(&in, 1, "workspace/symbol", `{"query": "retry"}`)
+	writeRequest(&in, 2, "initialize", fmt.Sprintf(`{"rootUri": %q}`, pathToUri(dir)))
+	writeRequest(&in, 0, "initialized", `{}`)
+	writeRequest(&in, 3, "workspace/symbol", `{"query": "retry"}`)
+	writeRequest(&in, 4, "sol/search", `{"query": "retry*", "limit": 1, "pathOrder": true}`)
+	writeRequest(&in, 5, "sol/search", `{"query": "retry AND"}`)
+	writeRequest(&in, 6, "textDocument/hover", `{}`)
+	writeRequest(&in, 7, "shutdown", `null`)
+	writeRequest(&in, 0, "exit", `null`)
+
+	var out bytes.Buffer
+	exitCode := newLspServer(lspArgs{indexArgs: indexArgs{workers: 1}}, &in, &out, io.Discard).run()
+	assert.Equal(t, 0, exitCode)
+
+	responses := readResponses(t, &out)
+	assert.Equal(t, 7, len(responses))
+
+	assert.Equal(t, float64(rpcServerNotInitialized), responses[0]["error"].(map[string]interface{})["code"])
+	assert.Equal(t, true, responses[1]["result"].(map[string]interface{})["capabilities"].(map[string]interface{})["workspaceSymbolProvider"])
+
+	// the exact word first, at its rune column
+	var symbols []symbolInformation
+	remarshal(t, responses[2]["result"], &symbols)
+	assert.Equal(t, 2, len(symbols))
+	assert.Equal(t, "retry", symbols[0].Name)
+	assert.Equal(t, "a.go", symbols[0].ContainerName)
+	assert.Equal(t, pathToUri(filepath.Join(dir, "a.go")), symbols[0].Location.Uri)
+	assert.Equal(t, lspPosition{1, 6}, symbols[0].Location.Range.Start)
+	assert.Equal(t, lspPosition{1, 11}, symbols[0].Location.Range.End)
+	assert.Equal(t, "retryConnection", symbols[1].Name)
+	assert.Equal(t, lspPosition{0, 5}, symbols[1].Location.Range.Start)
+
+	var searched searchResponse
+	remarshal(t, responses[3]["result"], &searched)
+	assert.Equal(t, 2, searched.Total)
+	assert.Equal(t, 1, len(searched.Hits))
+	assert.Equal(t, int32(1), searched.Hits[0].Line)
+
+	assert.Equal(t, float64(rpcInvalidParams), responses[4]["error"].(map[string]interface{})["code"])
+	assert.Equal(t, float64(rpcMethodNotFound), responses[5]["error"].(map[string]interface{})["code"])
+	result, hasResult := responses[6]["result"]
+	assert.True(t, hasResult)
+	assert.Nil(t, result)
+}
+
+func TestLspWorkspaceSymbol(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	files := map[string]string{
+		// more words that start with the query than are answered, in a path before that of the exact word
+		"a.go": strings.Repeat("retryConnection\n", maxSymbols),
+		"b.go": "😀 retry retry𝒜\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	symbols := func(initialize string) ([]symbolInformation, map[string]interface{}) {
+		var in bytes.Buffer
+		writeRequest(&in, 1, "initialize", initialize)
+		writeRequest(&in, 2, "workspace/symbol", `{"query": "retry"}`)
+		writeRequest(&in, 3, "shutdown", `null`)
+		writeRequest(&in, 0, "exit", `null`)
+		var out bytes.Buffer
+		assert.Equal(t, 0, newLspServer(lspArgs{indexArgs: indexArgs{workers: 1}}, &in, &out, io.Discard).run())
+
+		responses := readResponses(t, &out)
+		var result []symbolInformation
+		remarshal(t, responses[1]["result"], &result)
+		return result, responses[0]["result"].(map[string]interface{})["capabilities"].(map[string]interface{})
+	}
+
+	// the exact word first, then the others up to maxSymbols; characters are counted in utf-16 units by default
+	result, capabilities := symbols(fmt.Sprintf(`{"rootUri": %q}`, pathToUri(dir)))
+	assert.Nil(t, capabilities["positionEncoding"])
+	assert.Equal(t, maxSymbols, len(result))
+	assert.Equal(t, "retry", result[0].Name)
+	assert.Equal(t, lspPosition{0, 3}, result[0].Location.Range.Start)
+	assert.Equal(t, lspPosition{0, 8}, result[0].Location.Range.End)
+	assert.Equal(t, "retryConnection", result[1].Name)
+	assert.Equal(t, "a.go", result[1].ContainerName)
+	assert.Equal(t, "retryConnection", result[maxSymbols-1].Name)
+
+	// or in runes, when the editor offers to
+	result, capabilities = symbols(fmt.Sprintf(`{"rootUri": %q, "capabilities": {"general": {"positionEncodings": `+
+		`["utf-16", "utf-32"]}}}`, pathToUri(dir)))
+	assert.Equal(t, "utf-32", capabilities["positionEncoding"])
+	assert.Equal(t, lspPosition{0, 2}, result[0].Location.Range.Start)
+	assert.Equal(t, lspPosition{0, 7}, result[0].Location.Range.End)
+
+	// a word with a rune outside the basic multilingual plane is longer in utf-16 units
+	if err := os.Remove(filepath.Join(dir, "a.go")); err != nil {
+		t.Fatal(err)
+	}
+	result, _ = symbols(fmt.Sprintf(`{"rootUri": %q}`, pathToUri(dir)))
+	assert.Equal(t, 2, len(result))
+	assert.Equal(t, "retry𝒜", result[1].Name)
+	assert.Equal(t, lspPosition{0, 9}, result[1].Location.Range.Start)
+	assert.Equal(t, lspPosition{0, 16}, result[1].Location.Range.End)
+}
+
+func TestUriToPath(t *testing.T) {
+	dir := t.TempDir()
+	assert.Equal(t, dir, uriToPath(pathToUri(dir)))
+	assert.Equal(t, "", uriToPath("https://example.com/dir"))
+}
+
+// write a request, or with id 0, a notification
+func writeRequest(w io.Writer, id int, method string, params string) {
+	idField := ""
+	if id != 0 {
+		idField = fmt.Sprintf(`"id": %v, `, id)
+	}
+	body := fmt.Sprintf(`{"jsonrpc": "2.0", %v"method": %q, "params": %v}`, idField, method, params)
+	fmt.Fprintf(w, "Content-Length: %v\r\n\r\n%v", len(body), body)
+}
+
+func readResponses(t *testing.T, r io.Reader) []map[string]interface{} {
+	var result []map[string]interface{}
+	reader := bufio.NewReader(r)
+	for {
+		headers, err := textproto.NewReader(reader).ReadMIMEHeader()
+		if err == io.EOF {
+			return result
+		}
+		assert.Nil(t, err)
+		length, _ := strconv.Atoi(headers.Get("Content-Length"))
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			t.Fatal(err)
+		}
+		var response map[string]interface{}
+		if err := json.Unmarshal(body, &response); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, response)
+	}
+}
+
+// decode value, as decoded into an interface{}, into result
+func remarshal(t *testing.T, value interface{}, result interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(encoded, result); err != nil {
+		t.Fatal(err)
+	}
+}
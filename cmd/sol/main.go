@@ -4,12 +4,15 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
-	"github.com/charmbracelet/lipgloss"
 	"github.com/sk-manyways/SearchOutlineLabel/internal/configfile"
 	"github.com/sk-manyways/SearchOutlineLabel/internal/fileutil"
 	"github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/query"
 	"github.com/sk-manyways/SearchOutlineLabel/internal/trie"
+	"io"
+	"io/fs"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -17,14 +20,25 @@ import (
 	"strings"
 )
 
-/*
-   return noPrefixArg, before, after
-*/
-func parseExecutionArgs(args []string) (*string, int32, int32, error) {
+type executionArgs struct {
+	// the non flag args, i.e. the query
+	noPrefixArgs  string
+	before        int32
+	after         int32
+	caseSensitive bool
+	perFile       bool
+	pathOrder     bool
+	// how hits are written: formatText, formatJson, formatJsonl, or formatVimgrep
+	format string
+}
+
+func parseExecutionArgs(args []string, caseSensitive bool) (executionArgs, error) {
 	var parseArgsErr error
-	var noPrefixArg *string
-	before := int32(0)
-	after := int32(0)
+	var noPrefixArgs []string
+	result := executionArgs{
+		caseSensitive: caseSensitive,
+		format:        formatText,
+	}
 
 	for idx, arg := range args {
 		args[idx] = strings.TrimSpace(arg)
@@ -36,7 +50,9 @@ func parseExecutionArgs(args []string) (*string, int32, int32, error) {
 			skip = false
 			continue
 		}
-		if arg == "--help" {
+		if arg == "" {
+			continue
+		} else if arg == "--help" {
 			printHelp()
 			os.Exit(0)
 		} else if arg[0:1] == "-" {
@@ -49,7 +65,7 @@ func parseExecutionArgs(args []string) (*string, int32, int32, error) {
 					if err != nil {
 						parseArgsErr = errors.New(fmt.Sprintf("invalid argument to A %s", args[idx+1]))
 					}
-					after = int32(afterCandidate)
+					result.after = int32(afterCandidate)
 					skip = true
 				}
 			} else if arg[1:] == "B" {
@@ -61,32 +77,185 @@ func parseExecutionArgs(args []string) (*string, int32, int32, error) {
 					if err != nil {
 						parseArgsErr = errors.New(fmt.Sprintf("invalid argument to B %s", args[idx+1]))
 					}
-					before = int32(beforeCandidate)
+					result.before = int32(beforeCandidate)
 					skip = true
 				}
+			} else if arg[1:] == "C" {
+				result.caseSensitive = true
+			} else if arg[1:] == "I" {
+				result.caseSensitive = false
+			} else if arg[1:] == "F" {
+				result.perFile = true
+			} else if arg[1:] == "P" {
+				result.pathOrder = true
+			} else if arg[1:] == "-format" {
+				if len(args) <= idx+1 {
+					parseArgsErr = errors.New(fmt.Sprintf("missing argument for format"))
+					break
+				}
+				format := args[idx+1]
+				if format != formatText && format != formatJson && format != formatJsonl && format != formatVimgrep {
+					parseArgsErr = errors.New(fmt.Sprintf("invalid argument to format %s, expected text, json, jsonl, or vimgrep", format))
+				}
+				result.format = format
+				skip = true
 			} else {
 				parseArgsErr = errors.New(fmt.Sprintf("unexpected arg %s", arg))
 			}
 		} else {
-			duplicateArg := arg
-			noPrefixArg = &duplicateArg
+			noPrefixArgs = append(noPrefixArgs, arg)
 		}
 	}
 
-	if noPrefixArg == nil {
+	if len(noPrefixArgs) == 0 {
 		parseArgsErr = errors.New("expected a search term as input")
+	} else {
+		result.noPrefixArgs = strings.Join(noPrefixArgs, " ")
+	}
+
+	return result, parseArgsErr
+}
+
+// indexArgs are the flags, of sol, sol search, sol serve, and sol lsp, that decide which files are indexed, and how
+type indexArgs struct {
+	additionalFileExtensionsToIgnore []string
+	workers                          int
+	// skip the patterns of .gitignore, .ignore and .solignore files
+	noIgnore bool
+	// from --include and --exclude, in order
+	rules []fullfileinfo.PathRule
+	// from --include-binary, files that are indexed even when they look binary
+	includeBinary []fullfileinfo.PathRule
+	// files larger than this many bytes are not indexed, 0 for no limit
+	maxFileSize int64
+	// index what symlinks refer to, rather than skipping them
+	followSymlinks bool
+}
+
+// files this large are mostly generated, or data, rather than something to search
+const defaultMaxFileSize = int64(20 * 1024 * 1024)
+
+func newIndexArgs() indexArgs {
+	return indexArgs{
+		additionalFileExtensionsToIgnore: make([]string, 0),
+		workers:                          runtime.NumCPU(),
+		maxFileSize:                      defaultMaxFileSize,
+	}
+}
+
+// parse the flag at args[idx] if it is an index flag, and return the number of args it takes, or 0 if it is not one
+func (index *indexArgs) parse(args []string, idx int) (int, error) {
+	switch args[idx] {
+	case "-EE":
+		extensionCount := 0
+		for idx+1+extensionCount < len(args) && args[idx+1+extensionCount] != "" && args[idx+1+extensionCount][0:1] != "-" {
+			index.additionalFileExtensionsToIgnore = append(index.additionalFileExtensionsToIgnore, "."+args[idx+1+extensionCount])
+			extensionCount++
+		}
+		if extensionCount == 0 {
+			return 0, errors.New("missing argument for EE")
+		}
+		return 1 + extensionCount, nil
+	case "-J":
+		if len(args) <= idx+1 {
+			return 0, errors.New("missing argument for J")
+		}
+		workersCandidate, err := strconv.Atoi(args[idx+1])
+		if err != nil || workersCandidate < 1 {
+			return 0, errors.New(fmt.Sprintf("invalid argument to J %s", args[idx+1]))
+		}
+		index.workers = workersCandidate
+		return 2, nil
+	case "--no-ignore":
+		index.noIgnore = true
+		return 1, nil
+	case "--include", "--exclude":
+		if len(args) <= idx+1 || args[idx+1] == "" {
+			return 0, errors.New(fmt.Sprintf("missing argument for %v", args[idx][2:]))
+		}
+		rule, err := fullfileinfo.ParsePathRule(args[idx+1], args[idx] == "--exclude")
+		if err != nil {
+			return 0, err
+		}
+		index.rules = append(index.rules, rule)
+		return 2, nil
+	case "--include-binary":
+		if len(args) <= idx+1 || args[idx+1] == "" {
+			return 0, errors.New("missing argument for include-binary")
+		}
+		rule, err := fullfileinfo.ParsePathRule(args[idx+1], false)
+		if err != nil {
+			return 0, err
+		}
+		index.includeBinary = append(index.includeBinary, rule)
+		return 2, nil
+	case "--follow":
+		index.followSymlinks = true
+		return 1, nil
+	case "--max-filesize":
+		if len(args) <= idx+1 {
+			return 0, errors.New("missing argument for max-filesize")
+		}
+		maxFileSize, err := parseSize(args[idx+1])
+		if err != nil {
+			return 0, err
+		}
+		index.maxFileSize = maxFileSize
+		return 2, nil
 	}
+	return 0, nil
+}
 
-	return noPrefixArg, before, after, parseArgsErr
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"G", 1024 * 1024 * 1024},
+	{"M", 1024 * 1024},
+	{"K", 1024},
 }
 
-/*
-   return pathToScan, additionalFileExtensionsToIgnore
-*/
-func parseArgs(args []string) (*string, []string, error) {
+// parse a number of bytes, optionally followed by K, M, or G, e.g. 512K or 20M
+func parseSize(size string) (int64, error) {
+	number := strings.TrimSuffix(strings.ToUpper(size), "B")
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number = strings.TrimSuffix(number, unit.suffix)
+			multiplier = unit.bytes
+			break
+		}
+	}
+	parsed, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || parsed < 0 || parsed > math.MaxInt64/multiplier {
+		return 0, errors.New(fmt.Sprintf("invalid size %s, expected e.g. 512K or 20M", size))
+	}
+	return parsed * multiplier, nil
+}
+
+// return size in the largest unit it is a whole number of, e.g. 20MB
+func formatSize(size int64) string {
+	for _, unit := range sizeUnits {
+		if size >= unit.bytes && size%unit.bytes == 0 {
+			return fmt.Sprintf("%v%vB", size/unit.bytes, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%vB", size)
+}
+
+type startupArgs struct {
+	pathToScan    string
+	watch         bool
+	caseSensitive bool
+	indexArgs
+}
+
+func parseArgs(args []string) (startupArgs, error) {
 	var parseArgsErr error
 	var pathToScan *string
-	additionalFileExtensionsToIgnore := make([]string, 0)
+	result := startupArgs{
+		indexArgs: newIndexArgs(),
+	}
 
 	for idx, arg := range args {
 		args[idx] = strings.TrimSpace(arg)
@@ -102,20 +271,15 @@ func parseArgs(args []string) (*string, []string, error) {
 			printHelp()
 			os.Exit(0)
 		} else if arg[0:1] == "-" {
-			if arg[1:] == "EE" {
-				if len(args) <= idx+1 {
-					parseArgsErr = errors.New(fmt.Sprintf("missing argument for EE"))
-					break
-				} else {
-					for k := idx + 1; k < len(args); k++ {
-						extensionsCandidate := args[k]
-						if extensionsCandidate[0:1] == "-" {
-							break
-						}
-						skip++
-						additionalFileExtensionsToIgnore = append(additionalFileExtensionsToIgnore, "."+args[k])
-					}
-				}
+			if taken, err := result.indexArgs.parse(args, idx); err != nil {
+				parseArgsErr = err
+				break
+			} else if taken > 0 {
+				skip = taken - 1
+			} else if arg[1:] == "W" {
+				result.watch = true
+			} else if arg[1:] == "C" {
+				result.caseSensitive = true
 			} else {
 				parseArgsErr = errors.New(fmt.Sprintf("unexpected arg %s", arg))
 			}
@@ -127,74 +291,161 @@ func parseArgs(args []string) (*string, []string, error) {
 
 	if pathToScan == nil {
 		parseArgsErr = errors.New("expected a pathToScan as input")
+	} else {
+		result.pathToScan = *pathToScan
 	}
 
-	return pathToScan, additionalFileExtensionsToIgnore, parseArgsErr
+	return result, parseArgsErr
 }
 
 func printHelp() {
-	fmt.Println("sol pathToScan [-EE space delimited list] \n" +
+	fmt.Println("sol pathToScan [-EE space delimited list] [-W] [-J int] [-C] [--no-ignore] [--include glob] [--exclude glob] [--include-binary glob] [--max-filesize size] [--follow]\n" +
+		"sol search pathToScan query [-EE space delimited list] [-J int] [--no-ignore] [--include glob] [--exclude glob] [--include-binary glob] [--max-filesize size] [--follow] [-B int] [-A int] [-C|-I] [-F] [-P] [--format text|json|jsonl|vimgrep]\n" +
 		"-EE: excluded extensions, files with these extensions will not be searched; for example -EE exe sql\n" +
+		"-W: watch for changes to files while running, and keep the index up to date (linux only)\n" +
+		"-J: number of files to index at the same time, defaults to the number of CPUs\n" +
+		"-C: search case sensitive by default\n" +
+		"--no-ignore: index files that .gitignore, .ignore, or .solignore files exclude\n" +
+		"--include, --exclude glob: only index, or do not index, paths below pathToScan that match glob, e.g.\n" +
+		"  --include 'src/**/*.go' --exclude '*_test.go'; may be repeated, the last that matches a path decides\n" +
+		"--include-binary glob: index the files that match glob, even when they look binary; may be repeated\n" +
+		"--max-filesize size: do not index files larger than size, e.g. 512K or 100M, defaults to 20M, 0 for no limit\n" +
+		"--follow: index the files and directories symlinks refer to, each once, rather than skipping symlinks\n" +
 		"\n" +
-		"During execution: [-B int] [-A int] search\n" +
+		"During execution: [-B int] [-A int] [-C|-I] [-F] [-P] [--format text|json|jsonl|vimgrep] query\n" +
 		"-B: print num lines of leading context before matching lines. \n" +
 		"-A: print num lines of trailing context after matching lines.\n" +
+		"-C: case sensitive search, only match words with the same case as search.\n" +
+		"-I: case insensitive search.\n" +
+		"-F: match the query against whole files, rather than single lines.\n" +
+		"-P: list matches by path and line number, rather than the most relevant first.\n" +
+		"--format: text (the default), json for a json array of matches, jsonl for a json object per line,\n" +
+		"  or vimgrep for path:line:column:text, as read by Vim's quickfix list and other editors.\n" +
+		"query: search terms, combined with AND, OR, NOT, and parentheses, e.g. retry AND timeout NOT test\n" +
+		"search*: prefix search, *search: suffix search, *search*: search anywhere in words.\n" +
+		"\"some phrase\": the words must directly follow each other, in order.\n" +
+		"~search, search~n: fuzzy search, words up to n edits (default 1, or 2 for longer words) from search.\n" +
+		"name:pattern, path:pattern: files by name, or by name or directory, e.g. name:*.go, path:gateway\n" +
+		"/regex/: lines that match the regular expression, e.g. /err(or)?\\s+\\d+/\n" +
+		"\n" +
+		"Note flags can be placed anywhere, e.g. this is valid: [-B int] query [-A int]\n" +
+		"\n" +
+		"sol search runs a single query, and exits with 0 if anything was found, 1 if not, and 2 on an error.\n" +
+		"\n" +
+		"sol serve pathToScan [--listen host:port] [-EE space delimited list] [-W] [-J int] [-C] [--no-ignore] [--include glob] [--exclude glob] [--include-binary glob] [--max-filesize size] [--follow]\n" +
+		"--listen: where to answer queries over http, defaults to 127.0.0.1:7700\n" +
+		"GET /search?q=query[&before=int][&after=int][&limit=int][&case=bool][&perFile=bool][&pathOrder=bool]\n" +
+		"GET /stats, POST /reindex\n" +
 		"\n" +
-		"Note flags can be placed anywhere, e.g. this is valid: [-B int] search [-A int]")
+		"sol lsp [pathToScan] [-EE space delimited list] [-W] [-J int] [-C] [--no-ignore] [--include glob] [--exclude glob] [--include-binary glob] [--max-filesize size] [--follow]\n" +
+		"speaks the language server protocol over stdio, answering workspace/symbol and sol/search requests;\n" +
+		"the workspace root is indexed, unless pathToScan is given")
 }
 
-func min(a int32, b int32) int32 {
-	if a < b {
-		return a
+const (
+	minWordLength   = int32(4)
+	limitLineLength = int32(120)
+)
+
+func main() {
+	if len(os.Args) >= 2 && os.Args[1] == "search" {
+		os.Exit(search(os.Args[2:]))
 	}
-	return b
-}
+	if len(os.Args) >= 2 && os.Args[1] == "lsp" {
+		os.Exit(lsp(os.Args[2:]))
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "serve" {
+		if err := serve(os.Args[2:]); err != nil {
+			log.Fatal(err.Error())
+		}
+		return
+	}
+	if len(os.Args) < 2 {
+		log.Fatal("Expected at least one argument - the path to scan")
+	}
+	startup, err := parseArgs(os.Args[1:])
 
-func splitIncludingTerm(s string, term string) []string {
-	if len(s) < len(term) {
-		return make([]string, 0)
+	if err != nil {
+		log.Fatal(err.Error())
 	}
 
-	var result []string
+	opened, err := openIndex(startup.pathToScan, startup.indexArgs, os.Stdout)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 
-	splitOnTerm := strings.Split(s, term)
+	if startup.watch {
+		watchForChanges(opened.trie, opened.filter)
+	}
 
-	for idx, split := range splitOnTerm {
-		if idx > 0 {
-			result = append(result, term)
+	reader := bufio.NewReader(os.Stdin)
+	for true {
+		fmt.Print("Search: ")
+		userInput, err := reader.ReadString('\n')
+		if err != nil && userInput == "" {
+			// stdin was closed
+			fmt.Println()
+			return
+		}
+		execution, err := parseExecutionArgs(query.Fields(userInput), startup.caseSensitive)
+		if err != nil {
+			fmt.Println(err.Error())
+			continue
+		}
+		expr, err := query.Parse(execution.noPrefixArgs)
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			continue
+		}
+		hits, err := query.Evaluate(expr, opened.trie, execution.options(opened.root))
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+		} else {
+			printHits(hits, execution)
 		}
-		result = append(result, split)
 	}
-
-	return result
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		log.Fatal("Expected at least one argument - the path to scan")
-	}
-	pathToScan, additionalFileExtensionsToIgnore, err := parseArgs(os.Args[1:])
+// openedIndex is the index of the files below root, along with what decided which files are indexed
+type openedIndex struct {
+	root      string
+	trie      *trie.Trie
+	indexPath string
+	filter    fullfileinfo.Filter
+	// the files that were found when the index was opened, but not indexed
+	skipped fullfileinfo.Skipped
+}
 
+// openIndex finds the files below pathToScan, and loads, or builds, their index. Progress is written to progress.
+func openIndex(pathToScan string, index indexArgs, progress io.Writer) (openedIndex, error) {
+	homeDir, err := getHomeDir()
 	if err != nil {
-		log.Fatal(err.Error())
+		return openedIndex{}, err
 	}
-
-	homeDir := getHomeDir()
 	solDirPath := filepath.Join(homeDir, ".sol")
-	solDirConfigPath := configfile.CreateDefaultConfig(solDirPath)
+	solDirConfigPath, err := configfile.CreateDefaultConfig(solDirPath)
+	if err != nil {
+		return openedIndex{}, err
+	}
 
 	var ignoreFileExtensions = make(map[string]struct{})
-	baseFileExtensionsToIgnore := configfile.GetExcludedExtensions(solDirConfigPath)
+	baseFileExtensionsToIgnore, err := configfile.GetExcludedExtensions(solDirConfigPath)
+	if err != nil {
+		return openedIndex{}, err
+	}
 	for _, ext := range baseFileExtensionsToIgnore {
 		ext = "." + ext
 		ignoreFileExtensions[ext] = struct{}{}
 	}
-	for _, ext := range additionalFileExtensionsToIgnore {
+	for _, ext := range index.additionalFileExtensionsToIgnore {
 		ignoreFileExtensions[ext] = struct{}{}
 	}
 
 	var ignoreDirectories = make(map[string]struct{})
-	baseDirectoriesToIgnore := configfile.GetExcludedDirectories(solDirConfigPath)
+	baseDirectoriesToIgnore, err := configfile.GetExcludedDirectories(solDirConfigPath)
+	if err != nil {
+		return openedIndex{}, err
+	}
 	for _, dir := range baseDirectoriesToIgnore {
 		ignoreDirectories[dir] = struct{}{}
 	}
@@ -202,79 +453,115 @@ func main() {
 	var ignoreDirectoryWithPrefix = make(map[string]struct{})
 	ignoreDirectoryWithPrefix["."] = struct{}{}
 
-	filesToScan := fullfileinfo.FindFilesRecursive(*pathToScan, ignoreFileExtensions, ignoreDirectories, ignoreDirectoryWithPrefix)
-
-	minWordLength := int32(4)
-	limitLineLength := int32(120)
+	// the rules of the config come first, so that those given at startup override them
+	var rules []fullfileinfo.PathRule
+	for _, section := range []struct {
+		patterns func(string) ([]string, error)
+		exclude  bool
+	}{
+		{configfile.GetIncludePatterns, false},
+		{configfile.GetExcludePatterns, true},
+	} {
+		patterns, err := section.patterns(solDirConfigPath)
+		if err != nil {
+			return openedIndex{}, err
+		}
+		for _, pattern := range patterns {
+			rule, err := fullfileinfo.ParsePathRule(pattern, section.exclude)
+			if err != nil {
+				return openedIndex{}, errors.New(fmt.Sprintf("%v in %v", err.Error(), solDirConfigPath))
+			}
+			rules = append(rules, rule)
+		}
+	}
+	rules = append(rules, index.rules...)
 
-	newTrie := trie.NewTrie(minWordLength)
-	for _, file := range filesToScan {
-		newTrie.Add(file)
+	absPathToScan, err := filepath.Abs(pathToScan)
+	if err != nil {
+		return openedIndex{}, err
+	}
+	if fileInfo, err := os.Stat(absPathToScan); err != nil {
+		return openedIndex{}, err
+	} else if !fileInfo.IsDir() {
+		return openedIndex{}, errors.New(fmt.Sprintf("%v is not a directory", pathToScan))
+	}
+	// the directories below it are skipped with a warning, if they can not be read, but it is of no use to search none
+	dir, err := os.Open(absPathToScan)
+	if err != nil {
+		return openedIndex{}, err
+	}
+	dir.Close()
+
+	opened := openedIndex{
+		root:      absPathToScan,
+		indexPath: indexFilePath(solDirPath, absPathToScan),
+		filter: fullfileinfo.Filter{
+			Root:                      absPathToScan,
+			IgnoreFileExtensions:      ignoreFileExtensions,
+			IgnoreDirectories:         ignoreDirectories,
+			IgnoreDirectoryWithPrefix: ignoreDirectoryWithPrefix,
+			UseIgnoreFiles:            !index.noIgnore,
+			Rules:                     rules,
+			IncludeBinary:             index.includeBinary,
+			MaxFileSize:               index.maxFileSize,
+			FollowSymlinks:            index.followSymlinks,
+		},
 	}
-	fmt.Printf("Found # files: %v\n", len(filesToScan))
 
-	var style = lipgloss.NewStyle().
-		Bold(true).
-		Foreground(lipgloss.Color("#FAFAFA")).
-		Background(lipgloss.Color("#7D56F4"))
+	// loaded before finding the files, so that the files it has unchanged are not read to tell whether they are binary
+	opened.trie = loadTrie(opened.indexPath, absPathToScan, minWordLength, progress)
+	filesToScan, skipped := opened.findFiles()
+	opened.skipped = skipped
 
-	for true {
-		reader := bufio.NewReader(os.Stdin)
-		fmt.Print("Search: ")
-		userInput, _ := reader.ReadString('\n')
-		split := strings.Split(userInput, " ")
-		toSearchForPtr, linesBefore, linesAfter, err := parseExecutionArgs(split)
-		if err != nil {
-			fmt.Println(err.Error())
-			continue
-		}
-		toSearchFor := *toSearchForPtr
-		toSearchFor = strings.ToLower(toSearchFor)
-		matchWord := true
-		if toSearchFor[len(toSearchFor)-1] == '*' {
-			toSearchFor = toSearchFor[0 : len(toSearchFor)-1]
-			matchWord = false
-		}
-		searchResult, err := newTrie.Search(toSearchFor, matchWord)
-		if err != nil {
-			fmt.Println("Error: " + err.Error())
-		} else {
-			for _, sr := range searchResult {
-				fmt.Printf("Line: %v, Path: %v\n", sr.LineNumber, sr.FullPath())
-				if linesBefore != 0 || linesAfter != 0 {
-					lines := fileutil.GetLinesFromFile(sr.FullPath(), sr.LineNumber-linesBefore, sr.LineNumber+linesAfter+1)
-					for _, line := range lines {
-						lineLengthToShow := min(limitLineLength, int32(len(line)))
-						lineLengthAdditional := ""
-						if lineLengthToShow < int32(len(line)) {
-							lineLengthAdditional = "..."
-						}
-						cappedLine := line[0:lineLengthToShow]
-
-						lineSplitOnSearchTerm := splitIncludingTerm(strings.ToLower(cappedLine), toSearchFor)
-						idxAt := 0
-						for _, linePart := range lineSplitOnSearchTerm {
-							// this maxIdx is done, because for cyrillic, characters are lost during toLower
-							maxIdx := min(int32(len(cappedLine)), int32(idxAt+len(linePart)))
-							lineInCorrectCase := cappedLine[idxAt:maxIdx]
-							idxAt += len(linePart)
-							if linePart == toSearchFor {
-								fmt.Print(style.Render(lineInCorrectCase))
-							} else {
-								fmt.Print(lineInCorrectCase)
-							}
-						}
-
-						fmt.Println(lineLengthAdditional)
-					}
-					fmt.Println()
-				}
-			}
+	opened.trie = syncOrBuildTrie(opened.trie, opened.indexPath, absPathToScan, minWordLength, filesToScan, index.workers,
+		progress)
+	fmt.Fprintf(progress, "Found # files: %v\n", len(filesToScan))
+	reportSkipped(skipped, opened.filter, opened.trie, progress)
+
+	return opened, nil
+}
+
+// findFiles returns the files below root that are to be indexed, and the number of files that were skipped, by why.
+// The files the index already has unchanged are taken to be indexed as before, without reading them.
+func (opened openedIndex) findFiles() ([]fullfileinfo.Full, fullfileinfo.Skipped) {
+	filter := opened.filter
+	if opened.trie != nil {
+		indexed := opened.trie
+		filter.Indexed = func(fullPath string, file fs.FileInfo) bool {
+			return indexed.Unchanged(fullfileinfo.NewFull(file, fullPath))
 		}
 	}
+	return fullfileinfo.FindFilesRecursive(opened.root, filter)
+}
+
+// report the files that were skipped, as filter decided, and those of indexed that are only shown in part
+func reportSkipped(skipped fullfileinfo.Skipped, filter fullfileinfo.Filter, indexed *trie.Trie, progress io.Writer) {
+	if skipped.Binary > 0 {
+		fmt.Fprintf(progress, "Skipped # binary files: %v (see --include-binary)\n", skipped.Binary)
+	}
+	if skipped.Symlink > 0 {
+		fmt.Fprintf(progress, "Skipped # symlinks: %v (see --follow)\n", skipped.Symlink)
+	}
+	if skipped.TooLarge > 0 {
+		fmt.Fprintf(progress, "Skipped # files larger than %v: %v (see --max-filesize)\n", formatSize(filter.MaxFileSize),
+			skipped.TooLarge)
+	}
+	if longLineFiles := indexed.LongLineFiles(); longLineFiles > 0 {
+		fmt.Fprintf(progress, "Truncated # files with lines longer than %v: %v (such lines are searched in full, but only "+
+			"their start is shown)\n", formatSize(fileutil.MaxLineLength), longLineFiles)
+	}
+}
+
+func (execution executionArgs) options(root string) query.Options {
+	return query.Options{
+		CaseSensitive: execution.caseSensitive,
+		PerFile:       execution.perFile,
+		PathOrder:     execution.pathOrder,
+		Root:          root,
+	}
 }
 
-func getHomeDir() string {
+func getHomeDir() (string, error) {
 	var homeDir string
 
 	if runtime.GOOS == "windows" {
@@ -287,8 +574,8 @@ func getHomeDir() string {
 	}
 
 	if homeDir == "" {
-		log.Fatal("The home directory is not set.")
+		return "", errors.New("the home directory is not set, it is where the index is kept")
 	}
 
-	return homeDir
+	return homeDir, nil
 }
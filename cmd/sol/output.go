@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fileutil"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/query"
+	"os"
+	"sort"
+	"strings"
+)
+
+// output formats of hits
+const (
+	formatText  = "text"
+	formatJson  = "json"
+	formatJsonl = "jsonl"
+	// path:line:column:text, as read by Vim's quickfix list and other editors
+	formatVimgrep = "vimgrep"
+)
+
+var style = lipgloss.NewStyle().
+	Bold(true).
+	Foreground(lipgloss.Color("#FAFAFA")).
+	Background(lipgloss.Color("#7D56F4"))
+
+// hitRecord is a hit as written by the json and jsonl formats
+type hitRecord struct {
+	Path string `json:"path"`
+	// 0 for a file that matches by name or path
+	Line    int32         `json:"line"`
+	Text    string        `json:"text,omitempty"`
+	Matches []matchRecord `json:"matches,omitempty"`
+	Before  []string      `json:"before,omitempty"`
+	After   []string      `json:"after,omitempty"`
+}
+
+// matchRecord is where a term, or regular expression, of the query matches the line
+type matchRecord struct {
+	Term string `json:"term"`
+	// the text of the line that matched
+	Text string `json:"text"`
+	// byte offsets in the line, the end excluded
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+func printHits(hits []query.Hit, execution executionArgs) {
+	switch execution.format {
+	case formatJson, formatJsonl:
+		printRecords(hits, execution)
+	case formatVimgrep:
+		for _, hit := range hits {
+			fmt.Println(vimgrepLine(hit, execution.caseSensitive))
+		}
+	default:
+		printText(hits, execution)
+	}
+}
+
+func printText(hits []query.Hit, execution executionArgs) {
+	for _, hit := range hits {
+		if hit.LineNumber == 0 {
+			// a file that matches by name or path
+			fmt.Printf("Path: %v\n", hit.FullPath())
+			continue
+		}
+		fmt.Printf("Line: %v, Path: %v", hit.LineNumber, hit.FullPath())
+		if words := hit.FuzzyWords(); len(words) > 0 {
+			fmt.Printf(", Matched: %v", strings.Join(words, ", "))
+		}
+		fmt.Println()
+		if execution.before != 0 || execution.after != 0 {
+			// without the file, e.g. as it was removed since it was indexed, there are no lines to show
+			lines, _ := fileutil.GetLinesFromFile(hit.FullPath(), hit.LineNumber-execution.before, hit.LineNumber+execution.after+1)
+			for _, line := range lines {
+				cappedLine, capped := capLine(line, int(limitLineLength))
+				printHighlighted(cappedLine, hitSpans(line, hit, execution.caseSensitive), style)
+				if capped {
+					fmt.Println("...")
+				} else {
+					fmt.Println()
+				}
+			}
+			fmt.Println()
+		}
+	}
+}
+
+// write a json array of the hits, or with jsonl, a json object per line
+func printRecords(hits []query.Hit, execution executionArgs) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+
+	records := make([]hitRecord, 0, len(hits))
+	for _, hit := range hits {
+		record := toRecord(hit, execution)
+		if execution.format == formatJsonl {
+			encoder.Encode(record)
+		} else {
+			records = append(records, record)
+		}
+	}
+
+	if execution.format == formatJson {
+		encoder.SetIndent("", "  ")
+		encoder.Encode(records)
+	}
+}
+
+func toRecord(hit query.Hit, execution executionArgs) hitRecord {
+	record := hitRecord{
+		Path: hit.FullPath(),
+		Line: hit.LineNumber,
+	}
+	if hit.LineNumber == 0 {
+		return record
+	}
+
+	firstLineNumber := hit.LineNumber - execution.before
+	if firstLineNumber < 1 {
+		firstLineNumber = 1
+	}
+	lines, _ := fileutil.GetLinesFromFile(hit.FullPath(), firstLineNumber, hit.LineNumber+execution.after+1)
+	lineIdx := int(hit.LineNumber - firstLineNumber)
+	if lineIdx >= len(lines) {
+		// the file changed, or was removed, since it was indexed
+		return record
+	}
+
+	record.Text = lines[lineIdx]
+	record.Before = lines[:lineIdx]
+	record.After = lines[lineIdx+1:]
+	record.Matches = matchRecords(record.Text, hit, execution.caseSensitive)
+
+	return record
+}
+
+// return where each term, and regular expression, matched by hit matches line, in order
+func matchRecords(line string, hit query.Hit, caseSensitive bool) []matchRecord {
+	var result []matchRecord
+	// a term matches several words on the line, each with its own terminal node, which all give the same spans when the
+	// line changed since it was indexed
+	seen := make(map[matchRecord]struct{})
+	add := func(term string, spans []span) {
+		for _, s := range spans {
+			record := matchRecord{term, line[s.start:s.end], s.start, s.end}
+			if _, exists := seen[record]; !exists {
+				seen[record] = struct{}{}
+				result = append(result, record)
+			}
+		}
+	}
+
+	for _, matched := range hit.Matches {
+		add(matched.Term.String(), termSpans(line, matched, caseSensitive))
+	}
+	for _, pattern := range hit.Patterns {
+		// the pattern is compiled with (?i) when searching case insensitive, which is not part of the query
+		add("/"+strings.TrimPrefix(pattern.String(), "(?i)")+"/", patternSpans(line, pattern))
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Start < result[j].Start
+	})
+	return result
+}
+
+// return hit as path:line:column:text, with the line and column counted from 1, and the column in bytes. A file that
+// matches by name or path is at line 1, column 1, without text.
+func vimgrepLine(hit query.Hit, caseSensitive bool) string {
+	if hit.LineNumber == 0 {
+		return fmt.Sprintf("%v:1:1:", hit.FullPath())
+	}
+
+	text := ""
+	if lines, _ := fileutil.GetLinesFromFile(hit.FullPath(), hit.LineNumber, hit.LineNumber+1); len(lines) > 0 {
+		text = lines[0]
+	}
+
+	// the index has the column of the words, the regular expressions are only matched once the line is read
+	column := int(hit.Column(caseSensitive))
+	for _, pattern := range hit.Patterns {
+		for _, s := range patternSpans(text, pattern) {
+			if column < 0 || s.start < column {
+				column = s.start
+			}
+			break
+		}
+	}
+	if column < 0 {
+		column = 0
+	}
+
+	return fmt.Sprintf("%v:%v:%v:%v", hit.FullPath(), hit.LineNumber, column+1, text)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/query"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/trie"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestToRecord(t *testing.T) {
+	fullPath := filepath.Join(t.TempDir(), "a.go")
+	content := "first line\n" +
+		"retry after a Timeout, then retries\n" +
+		"last line\n"
+	if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileInfo, _ := os.Stat(fullPath)
+	index := trie.NewTrie(4)
+	index.Add(fullfileinfo.NewFull(fileInfo, fullPath))
+
+	expr, _ := query.Parse("retr* AND /time\\w+/")
+	hits, err := query.Evaluate(expr, index, query.Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(hits))
+
+	record := toRecord(hits[0], executionArgs{before: 2, after: 0})
+	assert.Equal(t, hitRecord{
+		Path: fullPath,
+		Line: 2,
+		Text: "retry after a Timeout, then retries",
+		Matches: []matchRecord{
+			{"retr*", "retr", 0, 4},
+			{"/time\\w+/", "Timeout", 14, 21},
+			{"retr*", "retr", 28, 32},
+		},
+		Before: []string{"first line"},
+		After:  []string{},
+	}, record)
+
+	// a file matching by name has no line
+	expr, _ = query.Parse("name:*.go")
+	hits, _ = query.Evaluate(expr, index, query.Options{})
+	assert.Equal(t, hitRecord{Path: fullPath}, toRecord(hits[0], executionArgs{}))
+}
+
+func TestVimgrepLine(t *testing.T) {
+	fullPath := filepath.Join(t.TempDir(), "a.go")
+	if err := os.WriteFile(fullPath, []byte("first line\n\tconfig := Config{} // timeout\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileInfo, _ := os.Stat(fullPath)
+	index := trie.NewTrie(4)
+	index.Add(fullfileinfo.NewFull(fileInfo, fullPath))
+
+	tests := map[string]string{
+		"Config":               ":2:12:\tconfig := Config{} // timeout",
+		"timeout OR /conf\\w/": ":2:2:\tconfig := Config{} // timeout",
+		"/time\\w+/":           ":2:24:\tconfig := Config{} // timeout",
+		"name:a.go":            ":1:1:",
+	}
+	for input, expected := range tests {
+		expr, _ := query.Parse(input)
+		hits, err := query.Evaluate(expr, index, query.Options{CaseSensitive: true})
+		assert.Nil(t, err, input)
+		assert.Equal(t, fullPath+expected, vimgrepLine(hits[0], true), input)
+	}
+}
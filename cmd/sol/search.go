@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/query"
+	"os"
+)
+
+// exit codes of sol search, as with grep
+const (
+	exitFound    = 0
+	exitNotFound = 1
+	exitError    = 2
+)
+
+type searchArgs struct {
+	pathToScan string
+	execution  executionArgs
+	indexArgs
+}
+
+// parseSearchArgs parses the args of: sol search pathToScan query, with the flags of both startup and execution
+func parseSearchArgs(args []string) (searchArgs, error) {
+	result := searchArgs{
+		indexArgs: newIndexArgs(),
+	}
+
+	if len(args) == 0 || args[0] == "" || args[0][0:1] == "-" {
+		return result, errors.New("expected a pathToScan, followed by a query")
+	}
+	result.pathToScan = args[0]
+
+	var executionArgs []string
+	for idx := 1; idx < len(args); idx++ {
+		arg := args[idx]
+		if taken, err := result.indexArgs.parse(args, idx); err != nil {
+			return result, err
+		} else if taken > 0 {
+			idx += taken - 1
+		} else {
+			executionArgs = append(executionArgs, arg)
+		}
+	}
+
+	execution, err := parseExecutionArgs(executionArgs, false)
+	result.execution = execution
+	return result, err
+}
+
+// search runs a single query, prints the hits, and returns the exit code: exitFound, exitNotFound, or exitError.
+// Progress, and errors, are written to stderr, so that stdout only has the hits.
+func search(args []string) int {
+	parsed, err := parseSearchArgs(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: "+err.Error())
+		return exitError
+	}
+
+	expr, err := query.Parse(parsed.execution.noPrefixArgs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: "+err.Error())
+		return exitError
+	}
+
+	opened, err := openIndex(parsed.pathToScan, parsed.indexArgs, os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: "+err.Error())
+		return exitError
+	}
+
+	hits, err := query.Evaluate(expr, opened.trie, parsed.execution.options(opened.root))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: "+err.Error())
+		return exitError
+	}
+
+	printHits(hits, parsed.execution)
+
+	if len(hits) == 0 {
+		return exitNotFound
+	}
+	return exitFound
+}
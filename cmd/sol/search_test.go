@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/query"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSearchArgs(t *testing.T) {
+	parsed, err := parseSearchArgs([]string{"./src", "-A", "2", "retry", "-EE", "exe", "sql", "-J", "3", "timeout", "-C"})
+	assert.Nil(t, err)
+	assert.Equal(t, "./src", parsed.pathToScan)
+	assert.Equal(t, []string{".exe", ".sql"}, parsed.additionalFileExtensionsToIgnore)
+	assert.Equal(t, 3, parsed.workers)
+	assert.Equal(t, "retry timeout", parsed.execution.noPrefixArgs)
+	assert.Equal(t, int32(2), parsed.execution.after)
+	assert.True(t, parsed.execution.caseSensitive)
+
+	_, err = parseSearchArgs([]string{})
+	assert.NotNil(t, err)
+
+	_, err = parseSearchArgs([]string{"-A", "2", "./src", "retry"})
+	assert.NotNil(t, err)
+
+	_, err = parseSearchArgs([]string{"./src"})
+	assert.NotNil(t, err)
+
+	_, err = parseSearchArgs([]string{"./src", "retry", "-J", "none"})
+	assert.NotNil(t, err)
+
+	parsed, err = parseSearchArgs([]string{"./src", "--include", "src/**/*.go", "retry", "--exclude", "!keep_test.go"})
+	assert.Nil(t, err)
+	assert.Equal(t, []fullfileinfo.PathRule{{Glob: "src/**/*.go"}, {Glob: "**/keep_test.go"}}, parsed.rules)
+	assert.Equal(t, "retry", parsed.execution.noPrefixArgs)
+
+	_, err = parseSearchArgs([]string{"./src", "retry", "--include"})
+	assert.NotNil(t, err)
+
+	parsed, err = parseSearchArgs([]string{"./src", "retry"})
+	assert.Nil(t, err)
+	assert.Equal(t, defaultMaxFileSize, parsed.maxFileSize)
+	assert.False(t, parsed.followSymlinks)
+	parsed, err = parseSearchArgs([]string{"./src", "--max-filesize", "0", "retry", "--follow"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), parsed.maxFileSize)
+	assert.True(t, parsed.followSymlinks)
+
+	_, err = parseSearchArgs([]string{"./src", "retry", "--max-filesize", "big"})
+	assert.NotNil(t, err)
+}
+
+func TestParseExecutionArgsTypedIn(t *testing.T) {
+	// as the interactive search reads a query: flags are only taken from outside quotes and regular expressions
+	execution, err := parseExecutionArgs(query.Fields(`/foo  bar/ -A 2 "connection -refused" /x -B y/`+"\n"), false)
+	assert.Nil(t, err)
+	assert.Equal(t, `/foo  bar/ "connection -refused" /x -B y/`, execution.noPrefixArgs)
+	assert.Equal(t, int32(2), execution.after)
+	assert.Equal(t, int32(0), execution.before)
+}
+
+func TestSearchIncludeBinary(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.dat"), []byte("retry\x00the connection\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, exitNotFound, search([]string{dir, "retry"}))
+	assert.Equal(t, exitFound, search([]string{dir, "retry", "--include-binary", "*.dat"}))
+	// the stored index has the file unchanged, but it is left out again without the flag
+	assert.Equal(t, exitNotFound, search([]string{dir, "retry"}))
+}
+
+func TestParseSize(t *testing.T) {
+	sizes := map[string]int64{
+		"100":  100,
+		"512K": 512 * 1024,
+		"20M":  20 * 1024 * 1024,
+		"20mb": 20 * 1024 * 1024,
+		"1G":   1024 * 1024 * 1024,
+	}
+	for size, expected := range sizes {
+		parsed, err := parseSize(size)
+		assert.Nil(t, err, size)
+		assert.Equal(t, expected, parsed, size)
+	}
+
+	for _, size := range []string{"", "M", "-1K", "1.5M", "1T", "99999999999G"} {
+		_, err := parseSize(size)
+		assert.NotNil(t, err, size)
+	}
+
+	assert.Equal(t, "20MB", formatSize(20*1024*1024))
+	assert.Equal(t, "1536KB", formatSize(1536*1024))
+	assert.Equal(t, "100B", formatSize(100))
+}
+
+func TestSearchExitCodes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("retry the connection\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, exitFound, search([]string{dir, "retry"}))
+	assert.Equal(t, exitNotFound, search([]string{dir, "timeout"}))
+	assert.Equal(t, exitError, search([]string{dir, "retry", "AND"}))
+	assert.Equal(t, exitError, search([]string{filepath.Join(dir, "missing"), "retry"}))
+	assert.Equal(t, exitError, search([]string{filepath.Join(dir, "a.go"), "retry"}))
+
+	// the index, and the config, can not be kept without a home directory, or below a file
+	t.Setenv("HOME", "")
+	t.Setenv("USERPROFILE", "")
+	assert.Equal(t, exitError, search([]string{dir, "retry"}))
+	t.Setenv("HOME", filepath.Join(dir, "a.go"))
+	t.Setenv("USERPROFILE", filepath.Join(dir, "a.go"))
+	assert.Equal(t, exitError, search([]string{dir, "retry"}))
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/query"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultListen = "127.0.0.1:7700"
+
+type serveArgs struct {
+	pathToScan    string
+	watch         bool
+	caseSensitive bool
+	listen        string
+	indexArgs
+}
+
+// parseServeArgs parses the args of: sol serve pathToScan, with the startup flags and --listen
+func parseServeArgs(args []string) (serveArgs, error) {
+	result := serveArgs{
+		listen:    defaultListen,
+		indexArgs: newIndexArgs(),
+	}
+
+	if len(args) == 0 || args[0] == "" || args[0][0:1] == "-" {
+		return result, errors.New("expected a pathToScan")
+	}
+	result.pathToScan = args[0]
+
+	for idx := 1; idx < len(args); idx++ {
+		arg := args[idx]
+		if taken, err := result.indexArgs.parse(args, idx); err != nil {
+			return result, err
+		} else if taken > 0 {
+			idx += taken - 1
+		} else if arg == "--listen" {
+			if len(args) <= idx+1 || args[idx+1] == "" {
+				return result, errors.New("missing argument for listen")
+			}
+			result.listen = args[idx+1]
+			idx++
+		} else if arg == "-W" {
+			result.watch = true
+		} else if arg == "-C" {
+			result.caseSensitive = true
+		} else {
+			return result, errors.New(fmt.Sprintf("unexpected arg %s", arg))
+		}
+	}
+
+	return result, nil
+}
+
+// serve indexes the files below the path to scan, and answers queries over http until it is stopped
+func serve(args []string) error {
+	parsed, err := parseServeArgs(args)
+	if err != nil {
+		return err
+	}
+
+	opened, err := openIndex(parsed.pathToScan, parsed.indexArgs, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	if parsed.watch {
+		watchForChanges(opened.trie, opened.filter)
+	}
+
+	fmt.Printf("Listening on http://%v\n", parsed.listen)
+	return http.ListenAndServe(parsed.listen, newServer(opened, parsed.workers, parsed.caseSensitive, os.Stdout))
+}
+
+// server answers queries over http against one index. Searches run while the index is being re-indexed, the trie
+// guards itself.
+type server struct {
+	opened        openedIndex
+	workers       int
+	caseSensitive bool
+	progress      io.Writer
+
+	mu         sync.Mutex
+	reindexing bool
+	indexedAt  time.Time
+	skipped    fullfileinfo.Skipped
+}
+
+func newServer(opened openedIndex, workers int, caseSensitive bool, progress io.Writer) http.Handler {
+	s := &server{
+		opened:        opened,
+		workers:       workers,
+		caseSensitive: caseSensitive,
+		progress:      progress,
+		indexedAt:     time.Now(),
+		skipped:       opened.skipped,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search", s.handleSearch)
+	mux.HandleFunc("/stats", s.handleStats)
+	mux.HandleFunc("/reindex", s.handleReindex)
+	return mux
+}
+
+type searchResponse struct {
+	Query string `json:"query"`
+	// the number of hits, which may be more than are listed, when limited
+	Total int         `json:"total"`
+	Hits  []hitRecord `json:"hits"`
+}
+
+// handleSearch answers /search?q=query, with the optional parameters before, after, limit, case (true or false),
+// perFile and pathOrder
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := params.Get("q")
+	if q == "" {
+		writeError(w, http.StatusBadRequest, errors.New("expected a query, as q"))
+		return
+	}
+
+	execution := executionArgs{
+		noPrefixArgs:  q,
+		caseSensitive: s.caseSensitive,
+		format:        formatJson,
+	}
+	var err error
+	var limit int32
+	if execution.before, err = intParam(params.Get("before")); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("invalid before: %v", err.Error())))
+		return
+	}
+	if execution.after, err = intParam(params.Get("after")); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("invalid after: %v", err.Error())))
+		return
+	}
+	if limit, err = intParam(params.Get("limit")); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("invalid limit: %v", err.Error())))
+		return
+	}
+	if execution.caseSensitive, err = boolParam(params.Get("case"), s.caseSensitive); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("invalid case: %v", err.Error())))
+		return
+	}
+	if execution.perFile, err = boolParam(params.Get("perFile"), false); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("invalid perFile: %v", err.Error())))
+		return
+	}
+	if execution.pathOrder, err = boolParam(params.Get("pathOrder"), false); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("invalid pathOrder: %v", err.Error())))
+		return
+	}
+
+	response, err := searchIndex(s.opened, execution, limit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJson(w, http.StatusOK, response)
+}
+
+// searchIndex runs the query of execution against the index, and returns at most limit hits, or all of them when limit
+// is 0
+func searchIndex(opened openedIndex, execution executionArgs, limit int32) (searchResponse, error) {
+	expr, err := query.Parse(execution.noPrefixArgs)
+	if err != nil {
+		return searchResponse{}, err
+	}
+	hits, err := query.Evaluate(expr, opened.trie, execution.options(opened.root))
+	if err != nil {
+		return searchResponse{}, err
+	}
+
+	response := searchResponse{
+		Query: execution.noPrefixArgs,
+		Total: len(hits),
+		Hits:  make([]hitRecord, 0, len(hits)),
+	}
+	if limit > 0 && int(limit) < len(hits) {
+		hits = hits[:limit]
+	}
+	for _, hit := range hits {
+		response.Hits = append(response.Hits, toRecord(hit, execution))
+	}
+	return response, nil
+}
+
+type statsResponse struct {
+	Root  string `json:"root"`
+	Files int    `json:"files"`
+	// the files found, but not indexed, as they look binary, are larger than --max-filesize, or are symlinks
+	SkippedBinary   int `json:"skippedBinary"`
+	SkippedTooLarge int `json:"skippedTooLarge"`
+	SkippedSymlinks int `json:"skippedSymlinks"`
+	// the indexed files with lines longer than fileutil.MaxLineLength, which are only shown in part
+	Truncated  int       `json:"truncated"`
+	Reindexing bool      `json:"reindexing"`
+	IndexedAt  time.Time `json:"indexedAt"`
+}
+
+func (s *server) handleStats(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	response := statsResponse{
+		Root:            s.opened.root,
+		SkippedBinary:   s.skipped.Binary,
+		SkippedTooLarge: s.skipped.TooLarge,
+		SkippedSymlinks: s.skipped.Symlink,
+		Reindexing:      s.reindexing,
+		IndexedAt:       s.indexedAt,
+	}
+	s.mu.Unlock()
+	response.Files = len(s.opened.trie.Files())
+	response.Truncated = s.opened.trie.LongLineFiles()
+
+	writeJson(w, http.StatusOK, response)
+}
+
+type reindexResponse struct {
+	// whether this request started re-indexing, rather than one that was already running
+	Started bool `json:"started"`
+}
+
+// handleReindex starts bringing the index up to date with the files below root, in the background, as with a restart.
+// Only POST is accepted, as it changes the index.
+func (s *server) handleReindex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("reindex expects a POST"))
+		return
+	}
+
+	s.mu.Lock()
+	started := !s.reindexing
+	s.reindexing = true
+	s.mu.Unlock()
+
+	if started {
+		go s.reindex()
+	}
+	writeJson(w, http.StatusAccepted, reindexResponse{Started: started})
+}
+
+func (s *server) reindex() {
+	filesToScan, skipped := s.opened.findFiles()
+	added, changed, removed := s.opened.trie.Sync(filesToScan, s.workers)
+	if added+changed+removed > 0 {
+		fmt.Fprintf(s.progress, "Updated index, files added: %v, changed: %v, removed: %v\n", added, changed, removed)
+		saveTrie(s.opened.trie, s.opened.indexPath, s.opened.root, s.progress)
+	}
+	reportSkipped(skipped, s.opened.filter, s.opened.trie, s.progress)
+
+	s.mu.Lock()
+	s.reindexing = false
+	s.indexedAt = time.Now()
+	s.skipped = skipped
+	s.mu.Unlock()
+}
+
+// return value as a non negative number, 0 when it is empty
+func intParam(value string) (int32, error) {
+	if value == "" {
+		return 0, nil
+	}
+	result, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	if result < 0 {
+		return 0, errors.New(fmt.Sprintf("%v is negative", value))
+	}
+	return int32(result), nil
+}
+
+// return value as a bool, defaultValue when it is empty
+func boolParam(value string, defaultValue bool) (bool, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJson(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(response)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseServeArgs(t *testing.T) {
+	parsed, err := parseServeArgs([]string{"./src", "--listen", "127.0.0.1:9000", "-EE", "exe", "-W", "-J", "2", "--no-ignore"})
+	assert.Nil(t, err)
+	assert.Equal(t, "./src", parsed.pathToScan)
+	assert.Equal(t, "127.0.0.1:9000", parsed.listen)
+	assert.Equal(t, []string{".exe"}, parsed.additionalFileExtensionsToIgnore)
+	assert.True(t, parsed.watch)
+	assert.Equal(t, 2, parsed.workers)
+	assert.True(t, parsed.noIgnore)
+
+	parsed, err = parseServeArgs([]string{"./src"})
+	assert.Nil(t, err)
+	assert.Equal(t, defaultListen, parsed.listen)
+
+	_, err = parseServeArgs([]string{"--listen", "127.0.0.1:9000"})
+	assert.NotNil(t, err)
+
+	_, err = parseServeArgs([]string{"./src", "--listen"})
+	assert.NotNil(t, err)
+
+	_, err = parseServeArgs([]string{"./src", "retry"})
+	assert.NotNil(t, err)
+}
+
+func TestServer(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("first line\nretry the connection\nretry again\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app"), []byte("\x7fELF\x02\x01\x00retry"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	opened, err := openIndex(dir, indexArgs{workers: 1}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(newServer(opened, 1, false, io.Discard))
+	defer ts.Close()
+
+	var searched searchResponse
+	status := getJson(t, ts.URL+"/search?q=retry&before=1&limit=1&pathOrder=true", &searched)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 2, searched.Total)
+	assert.Equal(t, 1, len(searched.Hits))
+	assert.Equal(t, int32(2), searched.Hits[0].Line)
+	assert.Equal(t, []string{"first line"}, searched.Hits[0].Before)
+
+	var failed errorResponse
+	assert.Equal(t, http.StatusBadRequest, getJson(t, ts.URL+"/search?q=retry+AND", &failed))
+	assert.Equal(t, "expected a search term after AND", failed.Error)
+	assert.Equal(t, http.StatusBadRequest, getJson(t, ts.URL+"/search?q=retry&limit=-1", &failed))
+	assert.Equal(t, http.StatusBadRequest, getJson(t, ts.URL+"/search", &failed))
+
+	var stats statsResponse
+	assert.Equal(t, http.StatusOK, getJson(t, ts.URL+"/stats", &stats))
+	assert.Equal(t, opened.root, stats.Root)
+	assert.Equal(t, 1, stats.Files)
+	assert.Equal(t, 1, stats.SkippedBinary)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, getJson(t, ts.URL+"/reindex", &failed))
+
+	// a file added after startup is found once re-indexed
+	if err := os.WriteFile(filepath.Join(dir, "b.go"), []byte("timeout\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.Post(ts.URL+"/reindex", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		getJson(t, ts.URL+"/stats", &stats)
+		if !stats.Reindexing || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 2, stats.Files)
+	getJson(t, ts.URL+"/search?q=timeout", &searched)
+	assert.Equal(t, 1, searched.Total)
+
+	// a file removed since it was indexed is still a hit, without its text, until the next re-index
+	if err := os.Remove(filepath.Join(dir, "b.go")); err != nil {
+		t.Fatal(err)
+	}
+	var removed searchResponse
+	assert.Equal(t, http.StatusOK, getJson(t, ts.URL+"/search?q=timeout", &removed))
+	assert.Equal(t, 1, len(removed.Hits))
+	assert.Equal(t, "", removed.Hits[0].Text)
+	assert.Equal(t, http.StatusOK, getJson(t, ts.URL+"/search?q=retry&before=1", &searched))
+	assert.Equal(t, 2, searched.Total)
+}
+
+// get url, decode its json into response, and return the status code
+func getJson(t *testing.T, url string, response interface{}) int {
+	result, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer result.Body.Close()
+	if err := json.NewDecoder(result.Body).Decode(response); err != nil {
+		t.Fatal(err)
+	}
+	return result.StatusCode
+}
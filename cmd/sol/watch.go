@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/trie"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/watch"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// how long a path must be left alone after a change, before it is re-indexed
+const watchDebounce = 300 * time.Millisecond
+
+// keep newTrie up to date with changes to the files below the root of filter, for as long as sol runs
+func watchForChanges(newTrie *trie.Trie, filter fullfileinfo.Filter) {
+	mayUseDirectory := func(fullPath string, fileInfo fs.FileInfo) bool {
+		return filter.MayUse(fullPath, fileInfo)
+	}
+
+	_, err := watch.New(filter.Root, mayUseDirectory, watchDebounce, func(fullPath string) {
+		reindexPath(newTrie, fullPath, filter)
+	})
+	if err != nil {
+		fmt.Printf("Not watching for changes: %v\n", err.Error())
+	}
+}
+
+// replace whatever is indexed for fullPath, a file or a directory, with its current content
+func reindexPath(newTrie *trie.Trie, fullPath string, filter fullfileinfo.Filter) {
+	if filter.UseIgnoreFiles && isIgnoreFile(fullPath) && fullPath != filter.Root {
+		// what is ignored in the whole directory may have changed
+		fullPath = filepath.Dir(fullPath)
+	}
+
+	var toAdd []fullfileinfo.Full
+	fileInfo, err := filter.Stat(fullPath)
+	if err == nil {
+		if fullPath == filter.Root {
+			toAdd, _ = fullfileinfo.FindFilesRecursive(fullPath, filter)
+		} else if filter.MayUse(fullPath, fileInfo) {
+			if fileInfo.IsDir() {
+				toAdd, _ = fullfileinfo.FindFilesRecursive(fullPath, filter)
+			} else {
+				toAdd = append(toAdd, fullfileinfo.NewFull(fileInfo, fullPath))
+			}
+		}
+	}
+
+	newTrie.Replace(fullPath, toAdd)
+}
+
+func isIgnoreFile(fullPath string) bool {
+	for _, name := range fullfileinfo.IgnoreFileNames {
+		if filepath.Base(fullPath) == name {
+			return true
+		}
+	}
+	return false
+}
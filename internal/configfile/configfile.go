@@ -3,7 +3,6 @@ package configfile
 import (
 	"github.com/sk-manyways/SearchOutlineLabel/internal/fileutil"
 	"io/ioutil"
-	"log"
 	"math"
 	"os"
 	"path/filepath"
@@ -16,20 +15,36 @@ const sectionExclExtensions = "[excl-extensions]"
 
 const sectionExclDirectories = "[excl-directories]"
 
-func GetExcludedExtensions(fullPath string) []string {
-	if _, exists := fileContent[fullPath]; !exists {
-		initFileContent(fullPath)
-	}
+const sectionInclude = "[include]"
+
+const sectionExclude = "[exclude]"
+
+func GetExcludedExtensions(fullPath string) ([]string, error) {
+	return getSection(sectionExclExtensions, fullPath)
+}
+
+func GetExcludedDirectories(fullPath string) ([]string, error) {
+	return getSection(sectionExclDirectories, fullPath)
+}
 
-	return getLinesInSection(sectionExclExtensions, *fileContent[fullPath])
+// GetIncludePatterns returns the glob patterns of the paths, relative to the path to scan, to index
+func GetIncludePatterns(fullPath string) ([]string, error) {
+	return getSection(sectionInclude, fullPath)
 }
 
-func GetExcludedDirectories(fullPath string) []string {
+// GetExcludePatterns returns the glob patterns of the paths, relative to the path to scan, not to index
+func GetExcludePatterns(fullPath string) ([]string, error) {
+	return getSection(sectionExclude, fullPath)
+}
+
+func getSection(section string, fullPath string) ([]string, error) {
 	if _, exists := fileContent[fullPath]; !exists {
-		initFileContent(fullPath)
+		if err := initFileContent(fullPath); err != nil {
+			return nil, err
+		}
 	}
 
-	return getLinesInSection(sectionExclDirectories, *fileContent[fullPath])
+	return getLinesInSection(section, *fileContent[fullPath]), nil
 }
 
 func getLinesInSection(section string, configFileContent []string) []string {
@@ -59,7 +74,8 @@ func getLinesInSection(section string, configFileContent []string) []string {
 	return result
 }
 
-func CreateDefaultConfig(directoryPath string) string {
+// CreateDefaultConfig writes the default config to directoryPath, unless there is one already, and returns its path
+func CreateDefaultConfig(directoryPath string) (string, error) {
 	data := []byte(`[excl-extensions]
 class
 jar
@@ -95,9 +111,13 @@ lib64
 parts
 sdist
 dist
+
+[include]
+
+[exclude]
 `)
 	if err := os.MkdirAll(directoryPath, 0755); err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 
 	dest := filepath.Join(directoryPath, ".solconfig")
@@ -105,18 +125,22 @@ dist
 	if os.IsNotExist(err) {
 		err := ioutil.WriteFile(dest, data, 0644)
 		if err != nil {
-			log.Fatal(err)
+			return "", err
 		}
 	}
 
-	return dest
+	return dest, nil
 }
 
 func sectionEnded(line string) bool {
-	return line == sectionExclExtensions || line == sectionExclDirectories
+	return line == sectionExclExtensions || line == sectionExclDirectories || line == sectionInclude || line == sectionExclude
 }
 
-func initFileContent(fullPath string) {
-	lines := fileutil.GetLinesFromFile(fullPath, 0, math.MaxInt32)
+func initFileContent(fullPath string) error {
+	lines, err := fileutil.GetLinesFromFile(fullPath, 0, math.MaxInt32)
+	if err != nil {
+		return err
+	}
 	fileContent[fullPath] = &lines
+	return nil
 }
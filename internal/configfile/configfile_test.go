@@ -8,7 +8,8 @@ import (
 )
 
 func TestGetExcludedDirectories(t *testing.T) {
-	excludedDirs := GetExcludedDirectories("testdata/.solconfig-1")
+	excludedDirs, err := GetExcludedDirectories("testdata/.solconfig-1")
+	assert.Nil(t, err)
 
 	expected := getExpectedDirs()
 
@@ -37,7 +38,8 @@ func getExpectedDirs() [11]string {
 }
 
 func TestGetExcludedExtensions(t *testing.T) {
-	excludedExtensions := GetExcludedExtensions("testdata/.solconfig-1")
+	excludedExtensions, err := GetExcludedExtensions("testdata/.solconfig-1")
+	assert.Nil(t, err)
 
 	expected := getExpectedExtensions()
 
@@ -84,9 +86,12 @@ func TestCreateDefaultConfig(t *testing.T) {
 	defer os.RemoveAll(tempDir)
 
 	finalPath := filepath.Join(tempDir, ".sol")
-	CreateDefaultConfig(finalPath)
+	configPath, err := CreateDefaultConfig(finalPath)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(finalPath, ".solconfig"), configPath)
 
-	excludedExtensions := GetExcludedExtensions(filepath.Join(finalPath, ".solconfig"))
+	excludedExtensions, err := GetExcludedExtensions(configPath)
+	assert.Nil(t, err)
 
 	expected := getExpectedExtensions()
 
@@ -94,7 +99,8 @@ func TestCreateDefaultConfig(t *testing.T) {
 		assert.Equal(t, expected[i], excludedExtensions[i])
 	}
 
-	excludedDirs := GetExcludedDirectories(filepath.Join(finalPath, ".solconfig"))
+	excludedDirs, err := GetExcludedDirectories(configPath)
+	assert.Nil(t, err)
 
 	expected2 := getExpectedDirs()
 
@@ -102,3 +108,32 @@ func TestCreateDefaultConfig(t *testing.T) {
 		assert.Equal(t, expected2[i], excludedDirs[i])
 	}
 }
+
+func TestGetIncludeAndExcludePatterns(t *testing.T) {
+	patterns, err := GetIncludePatterns("testdata/.solconfig-2")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"src/**/*.go", "!**/*_test.go"}, patterns)
+	patterns, err = GetExcludePatterns("testdata/.solconfig-2")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"src/generated"}, patterns)
+	patterns, err = GetExcludedDirectories("testdata/.solconfig-2")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{".git"}, patterns)
+
+	patterns, err = GetIncludePatterns("testdata/.solconfig-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, patterns)
+}
+
+func TestConfigErrors(t *testing.T) {
+	_, err := GetIncludePatterns(filepath.Join(t.TempDir(), "missing"))
+	assert.NotNil(t, err)
+
+	// the directory of the config can not be made below a file
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = CreateDefaultConfig(filepath.Join(file, ".sol"))
+	assert.NotNil(t, err)
+}
@@ -1,47 +1,58 @@
 package fileutil
 
-import (
-	"bufio"
-	"fmt"
-	"log"
-	"os"
-)
-
-func GetLinesFromFile(fullPath string, lineNoStart int32, lineNoEnd int32) []string {
+import "os"
+
+// GetLinesFromFile returns the lines from lineNoStart up to, but not including, lineNoEnd, each of at most
+// MaxLineLength bytes, and the error reading stopped at, if any. A file may have been removed, or changed, since it was
+// indexed, which is not worth stopping for.
+func GetLinesFromFile(fullPath string, lineNoStart int32, lineNoEnd int32) ([]string, error) {
 	file, err := os.Open(fullPath)
 	if err != nil {
-		log.Fatal(err.Error())
+		return nil, err
 	}
 	defer file.Close()
 
-	scanner := createScanner(file)
+	reader := NewLineReader(file)
 
 	var result []string
 
 	lineNumber := int32(0)
-	for scanner.Scan() {
+	for lineNumber+1 < lineNoEnd {
+		line, _, ok := reader.ReadLine(MaxLineLength)
+		if !ok {
+			break
+		}
 		lineNumber += 1
-		if lineNumber >= lineNoStart && lineNumber < lineNoEnd {
-			line := scanner.Text()
+		if lineNumber >= lineNoStart {
 			result = append(result, line)
-		} else if lineNumber >= lineNoEnd {
-			break
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Println(fmt.Sprintf("Error on line number scanning for file %v, error: %v", fullPath, err.Error()))
+	return result, reader.Err()
+}
+
+// ScanLines calls onLine with each line of the file, of at most MaxLineLength bytes, and its line number starting at 1,
+// until onLine returns false
+func ScanLines(fullPath string, onLine func(lineNumber int32, line string) bool) error {
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
 
-	return result
-}
+	reader := NewLineReader(file)
 
-func createScanner(file *os.File) *bufio.Scanner {
-	scanner := bufio.NewScanner(file)
+	lineNumber := int32(0)
+	for {
+		line, _, ok := reader.ReadLine(MaxLineLength)
+		if !ok {
+			break
+		}
+		lineNumber += 1
+		if !onLine(lineNumber, line) {
+			break
+		}
+	}
 
-	// Double the default buffer size
-	const maxCapacity = 2048 * 1024 // 2048KB
-	buf := make([]byte, maxCapacity)
-	scanner.Buffer(buf, maxCapacity)
-	return scanner
+	return reader.Err()
 }
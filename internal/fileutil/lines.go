@@ -0,0 +1,178 @@
+package fileutil
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+// ChunkSize is the most bytes of a line a LineReader holds at once
+const ChunkSize = 64 * 1024
+
+// MaxLineLength is the most bytes of a line GetLinesFromFile and ScanLines return, the rest of a longer line is left off
+const MaxLineLength = 2048 * 1024
+
+// LineReader reads lines of any length, in chunks of at most ChunkSize bytes, so that a long line, e.g. of minified
+// javascript, is read without holding all of it. A line is split between chunks at a rune boundary, and each line,
+// including an empty one, has at least one chunk. As with bufio.ScanLines, a trailing \r is not part of the line.
+type LineReader struct {
+	reader *bufio.Reader
+	// held by reader, until the next chunk is read
+	chunk      []byte
+	lineNumber int32
+	column     int
+	// whether the current chunk is the last of its line
+	lineEnded bool
+	err       error
+}
+
+func NewLineReader(r io.Reader) *LineReader {
+	return &LineReader{
+		// one byte more than a chunk, to tell whether a full chunk is the last of the input, and so ends its line
+		reader:    bufio.NewReaderSize(r, ChunkSize+1),
+		lineEnded: true,
+	}
+}
+
+// Next advances to the next chunk, and returns false at the end of the input, or on an error, see Err
+func (lr *LineReader) Next() bool {
+	if lr.err != nil {
+		return false
+	}
+	if lr.lineEnded {
+		lr.column = 0
+	} else {
+		lr.column += len(lr.chunk)
+	}
+
+	peeked, err := lr.reader.Peek(ChunkSize + 1)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		lr.err = err
+		return false
+	}
+
+	consumed := 0
+	if newline := bytes.IndexByte(peeked, '\n'); newline >= 0 {
+		lr.chunk = dropCR(peeked[:newline])
+		consumed = newline + 1
+		lr.endChunk(true)
+	} else if len(peeked) > ChunkSize {
+		peeked = peeked[:ChunkSize]
+		cut := lastRuneStart(peeked)
+		if cut == 0 || utf8.FullRune(peeked[cut:]) {
+			cut = len(peeked)
+		}
+		if peeked[cut-1] == '\r' && cut > 1 {
+			// keep \r with what follows it, so that a \r\n is not split
+			cut--
+		}
+		lr.chunk = peeked[:cut]
+		consumed = cut
+		lr.endChunk(false)
+	} else if len(peeked) > 0 {
+		// the last line, without a newline
+		lr.chunk = dropCR(peeked)
+		consumed = len(peeked)
+		lr.endChunk(true)
+	} else {
+		// the previous chunk, if any, was the last of the input, which ends its line
+		lr.lineEnded = true
+		return false
+	}
+
+	if _, err := lr.reader.Discard(consumed); err != nil {
+		lr.err = err
+		return false
+	}
+	return true
+}
+
+func (lr *LineReader) endChunk(lineEnded bool) {
+	if lr.lineEnded {
+		lr.lineNumber++
+	}
+	lr.lineEnded = lineEnded
+}
+
+// Peek returns the next n bytes, or fewer at the end of the input, without reading them, e.g. to look at the start of
+// the input before reading its lines. n is at most ChunkSize.
+func (lr *LineReader) Peek(n int) []byte {
+	peeked, err := lr.reader.Peek(n)
+	if err != nil && err != io.EOF {
+		lr.err = err
+	}
+	return peeked
+}
+
+// Chunk returns the current chunk
+func (lr *LineReader) Chunk() string {
+	return string(lr.chunk)
+}
+
+// LineNumber returns the line number of the current chunk, starting at 1
+func (lr *LineReader) LineNumber() int32 {
+	return lr.lineNumber
+}
+
+// Column returns the byte offset of the current chunk in its line, from 0
+func (lr *LineReader) Column() int {
+	return lr.column
+}
+
+// LineEnded returns whether the current chunk is the last of its line
+func (lr *LineReader) LineEnded() bool {
+	return lr.lineEnded
+}
+
+// Err returns the error reading stopped at, if any
+func (lr *LineReader) Err() error {
+	return lr.err
+}
+
+// ReadLine returns the next line, of at most maxLength bytes, whether it was longer than that, and false at the end of
+// the input
+func (lr *LineReader) ReadLine(maxLength int) (string, bool, bool) {
+	var line []byte
+	truncated := false
+	for lr.Next() {
+		if len(line)+len(lr.chunk) <= maxLength {
+			line = append(line, lr.chunk...)
+		} else {
+			if !truncated {
+				line = append(line, lr.chunk[:runeStartBefore(lr.chunk, maxLength-len(line))]...)
+			}
+			truncated = true
+		}
+		if lr.lineEnded {
+			return string(line), truncated, true
+		}
+	}
+	// the input ended in the middle of a line
+	return string(line), truncated, len(line) > 0
+}
+
+// return the offset of the start of the last rune in content, or 0 if there is none in the last utf8.UTFMax bytes
+func lastRuneStart(content []byte) int {
+	for idx := len(content) - 1; idx >= 0 && idx >= len(content)-utf8.UTFMax; idx-- {
+		if utf8.RuneStart(content[idx]) {
+			return idx
+		}
+	}
+	return 0
+}
+
+// return the start of the rune at, or if it is not a rune start, before, offset idx in content
+func runeStartBefore(content []byte, idx int) int {
+	for idx > 0 && idx < len(content) && !utf8.RuneStart(content[idx]) {
+		idx--
+	}
+	return idx
+}
+
+func dropCR(content []byte) []byte {
+	if len(content) > 0 && content[len(content)-1] == '\r' {
+		return content[:len(content)-1]
+	}
+	return content
+}
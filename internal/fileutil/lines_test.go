@@ -0,0 +1,86 @@
+package fileutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+type chunk struct {
+	text       string
+	lineNumber int32
+	column     int
+	lineEnded  bool
+}
+
+func readChunks(t *testing.T, content string) []chunk {
+	var result []chunk
+	reader := NewLineReader(strings.NewReader(content))
+	for reader.Next() {
+		result = append(result, chunk{reader.Chunk(), reader.LineNumber(), reader.Column(), reader.LineEnded()})
+	}
+	assert.Nil(t, reader.Err())
+	return result
+}
+
+func TestLineReader(t *testing.T) {
+	assert.Equal(t, []chunk{
+		{"first", 1, 0, true},
+		{"", 2, 0, true},
+		{"third", 3, 0, true},
+		{"last", 4, 0, true},
+	}, readChunks(t, "first\n\r\nthird\r\nlast"))
+	assert.Equal(t, 0, len(readChunks(t, "")))
+	assert.Equal(t, []chunk{{"only", 1, 0, true}}, readChunks(t, "only\n"))
+
+	// a long line is read in chunks, split at a rune boundary
+	long := strings.Repeat("a", ChunkSize-1) + "ü" + strings.Repeat("b", ChunkSize)
+	chunks := readChunks(t, long+"\nnext")
+	assert.Equal(t, 4, len(chunks))
+	assert.Equal(t, chunk{strings.Repeat("a", ChunkSize-1), 1, 0, false}, chunks[0])
+	assert.Equal(t, int32(1), chunks[1].lineNumber)
+	assert.Equal(t, ChunkSize-1, chunks[1].column)
+	assert.Equal(t, long, chunks[0].text+chunks[1].text+chunks[2].text)
+	assert.True(t, chunks[2].lineEnded)
+	assert.Equal(t, chunk{"next", 2, 0, true}, chunks[3])
+
+	// a \r\n is not split between chunks
+	chunks = readChunks(t, strings.Repeat("a", ChunkSize-1)+"\r\nnext")
+	assert.Equal(t, []chunk{
+		{strings.Repeat("a", ChunkSize-1), 1, 0, true},
+		{"next", 2, 0, true},
+	}, chunks)
+	chunks = readChunks(t, strings.Repeat("a", ChunkSize-1)+"\rb\nnext")
+	assert.Equal(t, []chunk{
+		{strings.Repeat("a", ChunkSize-1), 1, 0, false},
+		{"\rb", 1, ChunkSize - 1, true},
+		{"next", 2, 0, true},
+	}, chunks)
+
+	// a last line, without a newline, of exactly one chunk ends its line
+	last := strings.Repeat("a", ChunkSize-len("zebra")) + "zebra"
+	assert.Equal(t, []chunk{{last, 1, 0, true}}, readChunks(t, last))
+	assert.Equal(t, []chunk{{last, 1, 0, true}}, readChunks(t, last+"\n"))
+	assert.Equal(t, []chunk{{last, 1, 0, false}, {"b", 1, ChunkSize, true}}, readChunks(t, last+"b"))
+}
+
+func TestLineReaderReadLine(t *testing.T) {
+	reader := NewLineReader(strings.NewReader("short\n" + strings.Repeat("ü", ChunkSize) + "\nlast"))
+	line, truncated, ok := reader.ReadLine(10)
+	assert.Equal(t, "short", line)
+	assert.False(t, truncated)
+	assert.True(t, ok)
+
+	line, truncated, ok = reader.ReadLine(9)
+	assert.Equal(t, "üüüü", line)
+	assert.True(t, truncated)
+	assert.True(t, ok)
+
+	line, truncated, ok = reader.ReadLine(9)
+	assert.Equal(t, "last", line)
+	assert.False(t, truncated)
+	assert.True(t, ok)
+
+	_, _, ok = reader.ReadLine(9)
+	assert.False(t, ok)
+}
@@ -0,0 +1,56 @@
+package fullfileinfo
+
+import (
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// SniffLength is how much of the start of a file is read to decide whether it is binary
+const SniffLength = 8 * 1024
+
+// the share of bytes, in what is read, that may not be valid utf-8, before a file is taken to be binary. Text in other
+// encodings, e.g. Latin-1, only has a few such bytes.
+const maxInvalidRatio = 0.3
+
+// IsBinary returns whether the file at fullPath looks binary, rather than text: the start of it has a NUL byte, or too
+// many bytes that are not valid utf-8. A file that can not be read is not binary, indexing it reports the error.
+func IsBinary(fullPath string) bool {
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	buf := make([]byte, SniffLength)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false
+	}
+	return LooksBinary(buf[:n], n == SniffLength)
+}
+
+// LooksBinary returns whether content, the start of a file, looks binary, see IsBinary; with truncated, content is
+// only part of the file, so a rune may be cut off at its end
+func LooksBinary(content []byte, truncated bool) bool {
+	if len(content) == 0 {
+		return false
+	}
+
+	invalid := 0
+	for idx := 0; idx < len(content); {
+		if content[idx] == 0 {
+			return true
+		}
+		r, size := utf8.DecodeRune(content[idx:])
+		if r == utf8.RuneError && size == 1 {
+			if truncated && !utf8.FullRune(content[idx:]) {
+				break
+			}
+			invalid++
+		}
+		idx += size
+	}
+
+	return float64(invalid)/float64(len(content)) > maxInvalidRatio
+}
@@ -0,0 +1,65 @@
+package fullfileinfo
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLooksBinary(t *testing.T) {
+	assert.False(t, LooksBinary([]byte{}, false))
+	assert.False(t, LooksBinary([]byte("package main\n"), false))
+	assert.False(t, LooksBinary([]byte("Привет, мир\n"), false))
+	assert.True(t, LooksBinary([]byte("ELF\x00\x01\x02"), false))
+
+	// a few Latin-1 bytes are still text
+	assert.False(t, LooksBinary([]byte("caf\xe9 cr\xe8me br\xfbl\xe9e"), false))
+	assert.True(t, LooksBinary([]byte{0xff, 0xfe, 0x81, 0x92, 0xa3, 'a', 0xc0, 0xf5}, false))
+
+	// a rune cut off at the end of what was read is not counted as invalid
+	assert.False(t, LooksBinary([]byte("ab\xd0"), true))
+	assert.True(t, LooksBinary([]byte("ab\xd0"), false))
+}
+
+func TestFindFilesRecursiveBinary(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"main.go":         "package main\n",
+		"build/app":       "\x7fELF\x02\x01\x01\x00\x00",
+		"build/main.o":    "\xcf\xfa\xed\xfe\x07\x00\x00\x01",
+		"data/blob":       strings.Repeat("\xff\xfe\x81", 100),
+		"data/empty":      "",
+		"data/latin1.txt": "na\xefve caf\xe9\n",
+	})
+
+	filter := Filter{
+		Root:                      root,
+		IgnoreFileExtensions:      map[string]struct{}{},
+		IgnoreDirectories:         map[string]struct{}{},
+		IgnoreDirectoryWithPrefix: map[string]struct{}{},
+	}
+	files, skipped := FindFilesRecursive(root, filter)
+	assert.Equal(t, []string{"data/empty", "data/latin1.txt", "main.go"}, relativePaths(t, root, files))
+	assert.Equal(t, Skipped{Binary: 3}, skipped)
+
+	fileInfo, _ := os.Stat(filepath.Join(root, "build", "app"))
+	assert.False(t, filter.MayUse(filepath.Join(root, "build", "app"), fileInfo))
+
+	rule, _ := ParsePathRule("*.o", false)
+	filter.IncludeBinary = []PathRule{rule}
+	files, skipped = FindFilesRecursive(root, filter)
+	assert.Equal(t, []string{"build/main.o", "data/empty", "data/latin1.txt", "main.go"}, relativePaths(t, root, files))
+	assert.Equal(t, Skipped{Binary: 2}, skipped)
+
+	// a file that is already indexed as it is, is not read again
+	filter.IncludeBinary = nil
+	filter.Indexed = func(fullPath string, file fs.FileInfo) bool {
+		return fullPath == filepath.Join(root, "build", "app")
+	}
+	files, skipped = FindFilesRecursive(root, filter)
+	assert.Equal(t, []string{"build/app", "data/empty", "data/latin1.txt", "main.go"}, relativePaths(t, root, files))
+	assert.Equal(t, Skipped{Binary: 2}, skipped)
+}
@@ -0,0 +1,47 @@
+package fullfileinfo
+
+import (
+	"io/fs"
+	"time"
+)
+
+// fileInfo is a fs.FileInfo restored from stored metadata, rather than from a call to os.Stat
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func NewFileInfo(name string, size int64, mode fs.FileMode, modTime time.Time) fs.FileInfo {
+	return fileInfo{
+		name:    name,
+		size:    size,
+		mode:    mode,
+		modTime: modTime,
+	}
+}
+
+func (fi fileInfo) Name() string {
+	return fi.name
+}
+
+func (fi fileInfo) Size() int64 {
+	return fi.size
+}
+
+func (fi fileInfo) Mode() fs.FileMode {
+	return fi.mode
+}
+
+func (fi fileInfo) ModTime() time.Time {
+	return fi.modTime
+}
+
+func (fi fileInfo) IsDir() bool {
+	return fi.mode.IsDir()
+}
+
+func (fi fileInfo) Sys() any {
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+
+package fullfileinfo
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// fileId identifies a file, or directory, whatever path it is reached by; without a device and inode to go by, by
+// its path with every symlink resolved
+type fileId struct {
+	path string
+}
+
+// return the id of the file at fullPath, with fileInfo its stat, not its lstat, and whether it could be told
+func idOf(fullPath string, fileInfo fs.FileInfo) (fileId, bool) {
+	realPath, err := filepath.EvalSymlinks(fullPath)
+	if err != nil {
+		return fileId{}, false
+	}
+	realPath, err = filepath.Abs(realPath)
+	if err != nil {
+		return fileId{}, false
+	}
+	return fileId{path: realPath}, true
+}
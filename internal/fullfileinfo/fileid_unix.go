@@ -0,0 +1,23 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package fullfileinfo
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileId identifies a file, or directory, whatever path it is reached by
+type fileId struct {
+	device uint64
+	inode  uint64
+}
+
+// return the id of the file at fullPath, with fileInfo its stat, not its lstat, and whether it could be told
+func idOf(fullPath string, fileInfo fs.FileInfo) (fileId, bool) {
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileId{}, false
+	}
+	return fileId{device: uint64(stat.Dev), inode: uint64(stat.Ino)}, true
+}
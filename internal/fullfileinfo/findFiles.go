@@ -1,14 +1,15 @@
 package fullfileinfo
 
 import (
+	"fmt"
 	"io/fs"
 	"io/ioutil"
-	"log"
+	"os"
 	"path/filepath"
 	"strings"
 )
 
-func mayUseDirectory(file fs.FileInfo, ignoreDirectories map[string]struct{}, ignoreDirectoryWithPrefix map[string]struct{}) bool {
+func MayUseDirectory(file fs.FileInfo, ignoreDirectories map[string]struct{}, ignoreDirectoryWithPrefix map[string]struct{}) bool {
 	fileName := strings.ToLower(file.Name())
 	firstChar := string(fileName[0])
 	if _, exists := ignoreDirectoryWithPrefix[firstChar]; exists {
@@ -22,7 +23,7 @@ func mayUseDirectory(file fs.FileInfo, ignoreDirectories map[string]struct{}, ig
 	return true
 }
 
-func mayUseFile(file fs.FileInfo, ignoreFileExtensions map[string]struct{}) bool {
+func MayUseFile(file fs.FileInfo, ignoreFileExtensions map[string]struct{}) bool {
 	extension := strings.ToLower(filepath.Ext(file.Name()))
 
 	if _, exists := ignoreFileExtensions[extension]; exists {
@@ -32,39 +33,285 @@ func mayUseFile(file fs.FileInfo, ignoreFileExtensions map[string]struct{}) bool
 	return true
 }
 
-func FindFilesRecursive(pathToScan string,
-	ignoreFileExtensions map[string]struct{},
-	ignoreDirectories map[string]struct{},
-	ignoreDirectoryWithPrefix map[string]struct{}) []Full {
+// Filter decides which of the files and directories below Root are indexed
+type Filter struct {
+	Root                      string
+	IgnoreFileExtensions      map[string]struct{}
+	IgnoreDirectories         map[string]struct{}
+	IgnoreDirectoryWithPrefix map[string]struct{}
+	// whether the patterns of the ignore files, see IgnoreFileNames, in Root and the directories below it apply
+	UseIgnoreFiles bool
+	// include and exclude paths, the last rule that matches a path decides
+	Rules []PathRule
+	// files that look binary are left out, see IsBinary, unless the last of these rules that matches them includes them
+	IncludeBinary []PathRule
+	// optional, whether the file at fullPath is already indexed as it is, and was found not to look binary, so that it
+	// is not read again to tell
+	Indexed func(fullPath string, file fs.FileInfo) bool
+	// files larger than this many bytes are left out, 0 for no limit
+	MaxFileSize int64
+	// whether symlinks are followed, to the file or directory they refer to, rather than left out. Each file, and
+	// directory, is only used once, however many paths lead to it, which also ends cycles of symlinks.
+	FollowSymlinks bool
+}
+
+// Skipped counts the files that were found, and allowed by the filter, but are still not indexed, by why
+type Skipped struct {
+	// files that look binary
+	Binary int
+	// files larger than MaxFileSize
+	TooLarge int
+	// symlinks, as FollowSymlinks is not set
+	Symlink int
+}
+
+// Stat returns the file info of fullPath: of the file or directory it refers to, for a symlink that is followed, and of
+// fullPath itself otherwise
+func (filter Filter) Stat(fullPath string) (fs.FileInfo, error) {
+	fileInfo, err := os.Lstat(fullPath)
+	if err == nil && filter.FollowSymlinks && isSymlink(fileInfo) {
+		return os.Stat(fullPath)
+	}
+	return fileInfo, err
+}
+
+func isSymlink(fileInfo fs.FileInfo) bool {
+	return fileInfo.Mode()&fs.ModeSymlink != 0
+}
+
+// MayUse returns whether the file or directory at fullPath, below Root, is indexed, given that the directory it is in
+// is. file may be the lstat of fullPath, a symlink is judged by what it refers to, when symlinks are followed.
+func (filter Filter) MayUse(fullPath string, file fs.FileInfo) bool {
+	if isSymlink(file) {
+		if !filter.FollowSymlinks {
+			return false
+		}
+		target, err := os.Stat(fullPath)
+		if err != nil {
+			return false
+		}
+		file = target
+	}
+
+	if file.IsDir() {
+		if !MayUseDirectory(file, filter.IgnoreDirectories, filter.IgnoreDirectoryWithPrefix) {
+			return false
+		}
+	} else if !file.Mode().IsRegular() || !MayUseFile(file, filter.IgnoreFileExtensions) {
+		return false
+	}
+
+	if !filter.allowedByRules(fullPath, file.IsDir()) {
+		return false
+	}
+	if isIgnored(filter.ignoreFilesFor(filepath.Dir(fullPath)), fullPath, file.IsDir()) {
+		return false
+	}
+
+	return file.IsDir() || !filter.tooLarge(file) && !filter.skipBinary(fullPath, file)
+}
+
+func (filter Filter) tooLarge(file fs.FileInfo) bool {
+	return filter.MaxFileSize > 0 && file.Size() > filter.MaxFileSize
+}
+
+// return whether the file at fullPath looks binary, and is not included regardless
+func (filter Filter) skipBinary(fullPath string, file fs.FileInfo) bool {
+	if filter.Indexed != nil && filter.Indexed(fullPath, file) {
+		return false
+	}
+	if len(filter.IncludeBinary) > 0 {
+		if relativePath, err := filepath.Rel(filter.Root, fullPath); err == nil {
+			if includedByRules(filter.IncludeBinary, filepath.ToSlash(relativePath)) {
+				return false
+			}
+		}
+	}
+	return IsBinary(fullPath)
+}
+
+func (filter Filter) allowedByRules(fullPath string, isDir bool) bool {
+	if len(filter.Rules) == 0 {
+		return true
+	}
+	relativePath, err := filepath.Rel(filter.Root, fullPath)
+	if err != nil {
+		return true
+	}
+	return allowedByRules(filter.Rules, filepath.ToSlash(relativePath), isDir)
+}
+
+// return the ignore files that apply to what is in directory: those of Root, and of each directory from Root down to,
+// and including, directory
+func (filter Filter) ignoreFilesFor(directory string) []ignoreFile {
+	if !filter.UseIgnoreFiles || filter.Root == "" {
+		return nil
+	}
+	relativePath, err := filepath.Rel(filter.Root, directory)
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		return nil
+	}
+
+	result := loadIgnoreFiles(filter.Root)
+	atDirectory := filter.Root
+	for _, name := range strings.Split(relativePath, string(filepath.Separator)) {
+		if name == "." || name == "" {
+			continue
+		}
+		atDirectory = filepath.Join(atDirectory, name)
+		result = append(result, loadIgnoreFiles(atDirectory)...)
+	}
+	return result
+}
+
+// FindFilesRecursive returns the files below pathToScan, which is Root or a directory below it, that filter allows, and
+// the number of files that were skipped, by why
+func FindFilesRecursive(pathToScan string, filter Filter) ([]Full, Skipped) {
+	var ignoreFiles []ignoreFile
+	if pathToScan != filter.Root {
+		ignoreFiles = filter.ignoreFilesFor(filepath.Dir(pathToScan))
+	}
+
+	w := walk{filter: filter}
+	if filter.FollowSymlinks {
+		w.visited = make(map[fileId]struct{})
+	}
+	files := w.findFiles(pathToScan, ignoreFiles)
+
+	// symlinks are followed once everything else was found, so that a file that is also reached through a symlink, is
+	// found by its own path
+	for len(w.symlinks) > 0 {
+		link := w.symlinks[0]
+		w.symlinks = w.symlinks[1:]
+
+		file, err := os.Stat(link.fullPath)
+		if err != nil {
+			// a symlink to nothing
+			continue
+		}
+		if file.IsDir() {
+			if w.useDirectory(link.fullPath, file, link.ignoreFiles) {
+				files = append(files, w.findFiles(link.fullPath, link.ignoreFiles)...)
+			}
+		} else if full, ok := w.useFile(link.fullPath, file, link.ignoreFiles); ok {
+			files = append(files, full)
+		}
+	}
+
+	return files, w.skipped
+}
+
+// walk is what finding files below a directory keeps track of
+type walk struct {
+	filter  Filter
+	skipped Skipped
+	// when following symlinks, the files and directories found so far, which are not used again
+	visited map[fileId]struct{}
+	// the symlinks still to follow, with the ignore files of the directories they are in
+	symlinks []symlink
+}
+
+type symlink struct {
+	fullPath    string
+	ignoreFiles []ignoreFile
+}
+
+// return the files below pathToScan, with ignoreFiles those of the directories above it
+func (w *walk) findFiles(pathToScan string, ignoreFiles []ignoreFile) []Full {
+	if !w.firstVisit(pathToScan) {
+		// a cycle, or a directory that was reached by another path before
+		return nil
+	}
+
 	files, err := ioutil.ReadDir(pathToScan)
 
 	if err != nil {
-		log.Fatal(err.Error())
+		// the directory may have been removed since it was found, e.g. by a git checkout, which is not worth stopping for
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("Error reading directory %v, error: %v", pathToScan, err.Error()))
+		return nil
+	}
+
+	if w.filter.UseIgnoreFiles {
+		// a new slice, so that sibling directories do not share what is appended
+		ignoreFiles = append(ignoreFiles[:len(ignoreFiles):len(ignoreFiles)], loadIgnoreFiles(pathToScan)...)
 	}
 
 	var nextToScan []string
 	var result []Full
 
 	for _, file := range files {
-		if file.IsDir() {
-			if mayUseDirectory(file, ignoreDirectories, ignoreDirectoryWithPrefix) {
-				nextToScan = append(nextToScan, filepath.Join(pathToScan, file.Name()))
+		fullPath := filepath.Join(pathToScan, file.Name())
+		if isSymlink(file) {
+			if w.filter.FollowSymlinks {
+				w.symlinks = append(w.symlinks, symlink{fullPath, ignoreFiles})
+			} else {
+				w.skipped.Symlink++
 			}
-		} else {
-			if mayUseFile(file, ignoreFileExtensions) {
-				abs, err := filepath.Abs(filepath.Join(pathToScan, file.Name()))
-				if err != nil {
-					log.Fatal(err.Error())
-				}
-
-				result = append(result, NewFull(file, abs))
+		} else if file.IsDir() {
+			if w.useDirectory(fullPath, file, ignoreFiles) {
+				nextToScan = append(nextToScan, fullPath)
 			}
+		} else if full, ok := w.useFile(fullPath, file, ignoreFiles); ok {
+			result = append(result, full)
 		}
 	}
 
 	for _, nextDir := range nextToScan {
-		result = append(result, FindFilesRecursive(nextDir, ignoreFileExtensions, ignoreDirectories, ignoreDirectoryWithPrefix)...)
+		result = append(result, w.findFiles(nextDir, ignoreFiles)...)
 	}
 
 	return result
 }
+
+func (w *walk) useDirectory(fullPath string, file fs.FileInfo, ignoreFiles []ignoreFile) bool {
+	return MayUseDirectory(file, w.filter.IgnoreDirectories, w.filter.IgnoreDirectoryWithPrefix) &&
+		w.filter.allowedByRules(fullPath, true) && !isIgnored(ignoreFiles, fullPath, true)
+}
+
+// return the file at fullPath, and whether it is used; only regular files are, not e.g. sockets or devices
+func (w *walk) useFile(fullPath string, file fs.FileInfo, ignoreFiles []ignoreFile) (Full, bool) {
+	if !file.Mode().IsRegular() || !MayUseFile(file, w.filter.IgnoreFileExtensions) ||
+		!w.filter.allowedByRules(fullPath, false) || isIgnored(ignoreFiles, fullPath, false) {
+		return Full{}, false
+	}
+	if w.filter.tooLarge(file) {
+		w.skipped.TooLarge++
+		return Full{}, false
+	}
+	if w.filter.skipBinary(fullPath, file) {
+		w.skipped.Binary++
+		return Full{}, false
+	}
+	if !w.firstVisit(fullPath) {
+		// the same file, by another path
+		return Full{}, false
+	}
+
+	abs, err := filepath.Abs(fullPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("Error finding the absolute path of %v, error: %v", fullPath, err.Error()))
+		return Full{}, false
+	}
+	return NewFull(file, abs), true
+}
+
+// return whether the file or directory at fullPath was not found before, and remember it. Without following symlinks,
+// or when a file can not be told apart from others, every visit is the first.
+func (w *walk) firstVisit(fullPath string) bool {
+	if w.visited == nil {
+		return true
+	}
+	fileInfo, err := os.Stat(fullPath)
+	if err != nil {
+		return true
+	}
+	id, ok := idOf(fullPath, fileInfo)
+	if !ok {
+		return true
+	}
+	if _, exists := w.visited[id]; exists {
+		return false
+	}
+	w.visited[id] = struct{}{}
+	return true
+}
@@ -0,0 +1,101 @@
+package fullfileinfo
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindFilesRecursiveMaxFileSize(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"main.go":       "package main\n",
+		"data/dump.sql": strings.Repeat("insert into t values (1);\n", 100),
+	})
+
+	filter := Filter{
+		Root:                      root,
+		IgnoreFileExtensions:      map[string]struct{}{},
+		IgnoreDirectories:         map[string]struct{}{},
+		IgnoreDirectoryWithPrefix: map[string]struct{}{},
+		MaxFileSize:               1024,
+	}
+	files, skipped := FindFilesRecursive(root, filter)
+	assert.Equal(t, []string{"main.go"}, relativePaths(t, root, files))
+	assert.Equal(t, Skipped{TooLarge: 1}, skipped)
+
+	fileInfo, _ := os.Stat(filepath.Join(root, "data", "dump.sql"))
+	assert.False(t, filter.MayUse(filepath.Join(root, "data", "dump.sql"), fileInfo))
+
+	filter.MaxFileSize = 0
+	files, skipped = FindFilesRecursive(root, filter)
+	assert.Equal(t, 2, len(files))
+	assert.Equal(t, Skipped{}, skipped)
+}
+
+func TestFindFilesRecursiveRemovedDirectory(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"main.go": "package main\n"})
+	filter := Filter{
+		Root:                      root,
+		IgnoreFileExtensions:      map[string]struct{}{},
+		IgnoreDirectories:         map[string]struct{}{},
+		IgnoreDirectoryWithPrefix: map[string]struct{}{},
+	}
+
+	// e.g. a directory a watched change was reported for, which is gone by the time it is read
+	files, skipped := FindFilesRecursive(filepath.Join(root, "removed"), filter)
+	assert.Equal(t, 0, len(files))
+	assert.Equal(t, Skipped{}, skipped)
+}
+
+func TestFindFilesRecursiveSymlinks(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+	outside := filepath.Join(filepath.Dir(root), "outside")
+	writeFiles(t, root, map[string]string{
+		"main.go":     "package main\n",
+		"lib/util.go": "package lib\n",
+	})
+	writeFiles(t, outside, map[string]string{
+		"ext.go": "package ext\n",
+	})
+	symlinks := map[string]string{
+		// sorts before what it refers to, which is still found by its own path
+		"a_main.go": "main.go",
+		"a_lib":     "lib",
+		"lib/up":    "..",
+		"outside":   outside,
+		"broken":    "missing.go",
+	}
+	for name, target := range symlinks {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+
+	filter := Filter{
+		Root:                      root,
+		IgnoreFileExtensions:      map[string]struct{}{},
+		IgnoreDirectories:         map[string]struct{}{},
+		IgnoreDirectoryWithPrefix: map[string]struct{}{},
+	}
+	files, skipped := FindFilesRecursive(root, filter)
+	assert.Equal(t, []string{"lib/util.go", "main.go"}, relativePaths(t, root, files))
+	assert.Equal(t, Skipped{Symlink: 5}, skipped)
+
+	fileInfo, _ := os.Lstat(filepath.Join(root, "a_lib"))
+	assert.False(t, filter.MayUse(filepath.Join(root, "a_lib"), fileInfo))
+
+	// each file once, by its own path where it has one, and the cycle through lib/up ends
+	filter.FollowSymlinks = true
+	files, skipped = FindFilesRecursive(root, filter)
+	assert.Equal(t, []string{"lib/util.go", "main.go", "outside/ext.go"}, relativePaths(t, root, files))
+	assert.Equal(t, Skipped{}, skipped)
+
+	assert.True(t, filter.MayUse(filepath.Join(root, "a_lib"), fileInfo))
+	fileInfo, err := filter.Stat(filepath.Join(root, "a_lib"))
+	assert.Nil(t, err)
+	assert.True(t, fileInfo.IsDir())
+}
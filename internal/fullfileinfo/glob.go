@@ -0,0 +1,127 @@
+package fullfileinfo
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// MatchGlob returns whether name, a slash separated path, matches pattern segment by segment, as per path.Match, where
+// a ** segment matches any number of segments, including none, unless it ends pattern: dir/** matches what is below dir,
+// not dir itself
+func MatchGlob(pattern string, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// ValidateGlob returns path.ErrBadPattern when a segment of pattern is malformed
+func ValidateGlob(pattern string) error {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchSegments(patterns []string, names []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			if len(patterns) == 1 {
+				return len(names) > 0
+			}
+			for idx := 0; idx <= len(names); idx++ {
+				if matchSegments(patterns[1:], names[idx:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(patterns[0], names[0]); !matched {
+			return false
+		}
+		patterns = patterns[1:]
+		names = names[1:]
+	}
+	return len(names) == 0
+}
+
+// PathRule includes, or excludes, the files and directories whose path, relative to the root of a Filter, or the path
+// of a directory they are in, matches Glob
+type PathRule struct {
+	Glob    string
+	Exclude bool
+}
+
+// ParsePathRule returns the rule for an include pattern, or with exclude, an exclude pattern. A pattern starting with !
+// does the opposite, and a pattern without a /, other than at the end, matches a name at any depth, e.g. *.go is
+// **/*.go.
+func ParsePathRule(pattern string, exclude bool) (PathRule, error) {
+	if strings.HasPrefix(pattern, "!") {
+		exclude = !exclude
+		pattern = pattern[1:]
+	}
+	pattern = strings.TrimSuffix(pattern, "/")
+	// a / other than at the end, e.g. in ./vendor or /vendor, anchors the pattern to the root
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(strings.TrimPrefix(pattern, "./"), "/")
+	if pattern == "" {
+		return PathRule{}, errors.New("empty path pattern")
+	}
+	if !anchored {
+		pattern = "**/" + pattern
+	}
+	if err := ValidateGlob(pattern); err != nil {
+		return PathRule{}, errors.New(fmt.Sprintf("invalid path pattern %v: %v", pattern, err.Error()))
+	}
+	return PathRule{Glob: pattern, Exclude: exclude}, nil
+}
+
+// return whether the rule matches relativePath, a slash separated path, or a directory it is in
+func (rule PathRule) matches(relativePath string) bool {
+	for {
+		if MatchGlob(rule.Glob, relativePath) {
+			return true
+		}
+		idx := strings.LastIndex(relativePath, "/")
+		if idx < 0 {
+			return false
+		}
+		relativePath = relativePath[:idx]
+	}
+}
+
+// return whether rules allow relativePath: the last rule that matches decides. What no rule matches is allowed, unless
+// it is a file and there are rules that include.
+func allowedByRules(rules []PathRule, relativePath string, isDir bool) bool {
+	allowed := true
+	if !isDir {
+		for _, rule := range rules {
+			if !rule.Exclude {
+				allowed = false
+				break
+			}
+		}
+	}
+
+	for _, rule := range rules {
+		if rule.matches(relativePath) {
+			allowed = !rule.Exclude
+		}
+	}
+	return allowed
+}
+
+// return whether the last of rules that matches relativePath includes it, false when none match
+func includedByRules(rules []PathRule, relativePath string) bool {
+	included := false
+	for _, rule := range rules {
+		if rule.matches(relativePath) {
+			included = !rule.Exclude
+		}
+	}
+	return included
+}
@@ -0,0 +1,111 @@
+package fullfileinfo
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/sol/main.go", true},
+		{"cmd/**", "cmd/sol/main.go", true},
+		{"cmd/**", "cmd", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/y/c", false},
+		{"build/*.o", "build/x/main.o", false},
+		{"[^a]*.go", "main.go", true},
+		{"[^m]*.go", "main.go", false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, MatchGlob(test.pattern, test.name), test.pattern+" "+test.name)
+	}
+
+	assert.Nil(t, ValidateGlob("src/**/*.go"))
+	assert.NotNil(t, ValidateGlob("src/[a-"))
+}
+
+func TestParsePathRule(t *testing.T) {
+	rule, err := ParsePathRule("src/**/*.go", false)
+	assert.Nil(t, err)
+	assert.Equal(t, PathRule{Glob: "src/**/*.go"}, rule)
+
+	rule, _ = ParsePathRule("!*_test.go", false)
+	assert.Equal(t, PathRule{Glob: "**/*_test.go", Exclude: true}, rule)
+
+	rule, _ = ParsePathRule("./vendor/", true)
+	assert.Equal(t, PathRule{Glob: "vendor", Exclude: true}, rule)
+
+	rule, _ = ParsePathRule("!generated", true)
+	assert.Equal(t, PathRule{Glob: "**/generated"}, rule)
+
+	_, err = ParsePathRule("!", false)
+	assert.NotNil(t, err)
+	_, err = ParsePathRule("src/[a-", false)
+	assert.NotNil(t, err)
+}
+
+func TestAllowedByRules(t *testing.T) {
+	var rules []PathRule
+	for _, pattern := range []string{"src/**/*.go", "!**/*_test.go", "docs"} {
+		rule, _ := ParsePathRule(pattern, false)
+		rules = append(rules, rule)
+	}
+
+	tests := map[string]bool{
+		"src/main.go":          true,
+		"src/cmd/main.go":      true,
+		"src/cmd/main_test.go": false,
+		"src/readme.md":        false,
+		"main.go":              false,
+		"docs/guide.md":        true,
+		"docs/sub/guide.md":    true,
+	}
+	for relativePath, expected := range tests {
+		assert.Equal(t, expected, allowedByRules(rules, relativePath, false), relativePath)
+	}
+
+	// directories are only left out by a rule that excludes them, what is below may still be included
+	assert.True(t, allowedByRules(rules, "other", true))
+	exclude, _ := ParsePathRule("vendor", true)
+	assert.False(t, allowedByRules([]PathRule{exclude}, "vendor", true))
+	assert.False(t, allowedByRules([]PathRule{exclude}, "lib/vendor/a.go", false))
+	assert.True(t, allowedByRules([]PathRule{exclude}, "lib/a.go", false))
+}
+
+func TestFindFilesRecursiveRules(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"main.go":           "",
+		"src/a.go":          "",
+		"src/a_test.go":     "",
+		"src/vendor/lib.go": "",
+		"src/notes.md":      "",
+	})
+
+	var rules []PathRule
+	for _, pattern := range []string{"src/**/*.go", "!*_test.go"} {
+		rule, _ := ParsePathRule(pattern, false)
+		rules = append(rules, rule)
+	}
+	exclude, _ := ParsePathRule("vendor", true)
+	rules = append(rules, exclude)
+
+	filter := Filter{
+		Root:                      root,
+		IgnoreFileExtensions:      map[string]struct{}{},
+		IgnoreDirectories:         map[string]struct{}{},
+		IgnoreDirectoryWithPrefix: map[string]struct{}{},
+		Rules:                     rules,
+	}
+	assert.Equal(t, []string{"src/a.go"}, relativePaths(t, root, findFiles(root, filter)))
+	assert.Equal(t, []string{"src/a.go"}, relativePaths(t, root, findFiles(filepath.Join(root, "src"), filter)))
+}
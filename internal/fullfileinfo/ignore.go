@@ -0,0 +1,123 @@
+package fullfileinfo
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileNames are the files, in any directory, with gitignore patterns of what is not indexed. A pattern in a later
+// one of these overrides one in an earlier one, in the same directory.
+var IgnoreFileNames = []string{".gitignore", ".ignore", ".solignore"}
+
+// ignorePattern is a line of an ignore file
+type ignorePattern struct {
+	// relative to the directory of the ignore file, for MatchGlob
+	glob string
+	// a pattern starting with !, which includes again what an earlier pattern ignored
+	negate bool
+	// a pattern ending in /, which only matches directories
+	directoryOnly bool
+}
+
+// ignoreFile holds the patterns of an ignore file, which apply to the files and directories below its directory
+type ignoreFile struct {
+	directory string
+	patterns  []ignorePattern
+}
+
+// return the patterns of the ignore files in directory, in the order they apply
+func loadIgnoreFiles(directory string) []ignoreFile {
+	var result []ignoreFile
+	for _, name := range IgnoreFileNames {
+		patterns := readIgnoreFile(filepath.Join(directory, name))
+		if len(patterns) > 0 {
+			result = append(result, ignoreFile{directory, patterns})
+		}
+	}
+	return result
+}
+
+// return the patterns of the ignore file at fullPath, or none when it can not be read
+func readIgnoreFile(fullPath string) []ignorePattern {
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var result []ignorePattern
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if pattern, ok := parseIgnorePattern(scanner.Text()); ok {
+			result = append(result, pattern)
+		}
+	}
+	return result
+}
+
+// parse a line of an ignore file, as git does; false for blank lines, comments, and patterns that are not valid
+func parseIgnorePattern(line string) (ignorePattern, bool) {
+	var result ignorePattern
+
+	line = strings.TrimSuffix(line, "\r")
+	// trailing spaces are dropped, unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return result, false
+	}
+
+	if strings.HasPrefix(line, "!") {
+		result.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		result.directoryOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return result, false
+	}
+
+	// without a slash, other than at the end, a pattern matches a name at any depth, otherwise it is anchored to the
+	// directory of the ignore file
+	if strings.Contains(line, "/") {
+		result.glob = strings.TrimPrefix(line, "/")
+	} else {
+		result.glob = "**/" + line
+	}
+	// gitignore negates a character class with !, path.Match with ^
+	result.glob = strings.ReplaceAll(result.glob, "[!", "[^")
+
+	if ValidateGlob(result.glob) != nil {
+		return result, false
+	}
+	return result, true
+}
+
+// isIgnored returns whether the last of the patterns of ignoreFiles that matches fullPath ignores it
+func isIgnored(ignoreFiles []ignoreFile, fullPath string, isDir bool) bool {
+	ignored := false
+	for _, ignoreFile := range ignoreFiles {
+		relativePath, err := filepath.Rel(ignoreFile.directory, fullPath)
+		if err != nil || strings.HasPrefix(relativePath, "..") {
+			continue
+		}
+		relativePath = filepath.ToSlash(relativePath)
+		for _, pattern := range ignoreFile.patterns {
+			if pattern.directoryOnly && !isDir {
+				continue
+			}
+			if MatchGlob(pattern.glob, relativePath) {
+				ignored = !pattern.negate
+			}
+		}
+	}
+	return ignored
+}
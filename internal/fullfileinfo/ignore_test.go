@@ -0,0 +1,106 @@
+package fullfileinfo
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestParseIgnorePattern(t *testing.T) {
+	tests := map[string]ignorePattern{
+		"*.log":       {glob: "**/*.log"},
+		"/build":      {glob: "build"},
+		"build/":      {glob: "**/build", directoryOnly: true},
+		"doc/*.txt":   {glob: "doc/*.txt"},
+		"!keep.log":   {glob: "**/keep.log", negate: true},
+		"\\#file":     {glob: "**/#file"},
+		"[!a]*.tmp  ": {glob: "**/[^a]*.tmp"},
+	}
+	for line, expected := range tests {
+		pattern, ok := parseIgnorePattern(line)
+		assert.True(t, ok, line)
+		assert.Equal(t, expected, pattern, line)
+	}
+
+	for _, line := range []string{"", "   ", "# comment", "/", "[a-"} {
+		_, ok := parseIgnorePattern(line)
+		assert.False(t, ok, line)
+	}
+}
+
+func TestFindFilesRecursiveIgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".gitignore":          "*.log\n!keep.log\nbuild/\n/generated.go\n",
+		".solignore":          "vendor\n",
+		"main.go":             "",
+		"debug.log":           "",
+		"keep.log":            "",
+		"generated.go":        "",
+		"build/out.go":        "",
+		"vendor/lib.go":       "",
+		"cmd/generated.go":    "",
+		"cmd/build":           "",
+		"cmd/.ignore":         "*.tmp\n",
+		"cmd/scratch.tmp":     "",
+		"cmd/sub/scratch.tmp": "",
+		"other/scratch.tmp":   "",
+	})
+
+	filter := Filter{
+		Root:                      root,
+		IgnoreFileExtensions:      map[string]struct{}{},
+		IgnoreDirectories:         map[string]struct{}{},
+		IgnoreDirectoryWithPrefix: map[string]struct{}{},
+		UseIgnoreFiles:            true,
+	}
+	assert.Equal(t, []string{
+		".gitignore", ".solignore", "cmd/.ignore", "cmd/build", "cmd/generated.go", "keep.log", "main.go",
+		"other/scratch.tmp",
+	}, relativePaths(t, root, findFiles(root, filter)))
+
+	// below root, the ignore files of the directories above still apply
+	assert.Equal(t, []string{"cmd/.ignore", "cmd/build", "cmd/generated.go"},
+		relativePaths(t, root, findFiles(filepath.Join(root, "cmd"), filter)))
+
+	fileInfo, _ := os.Stat(filepath.Join(root, "cmd", "sub", "scratch.tmp"))
+	assert.False(t, filter.MayUse(filepath.Join(root, "cmd", "sub", "scratch.tmp"), fileInfo))
+	fileInfo, _ = os.Stat(filepath.Join(root, "vendor"))
+	assert.False(t, filter.MayUse(filepath.Join(root, "vendor"), fileInfo))
+
+	filter.UseIgnoreFiles = false
+	assert.Equal(t, 14, len(findFiles(root, filter)))
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		fullPath := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func relativePaths(t *testing.T, root string, files []Full) []string {
+	var result []string
+	for _, file := range files {
+		relativePath, err := filepath.Rel(root, file.FullPath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, filepath.ToSlash(relativePath))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// return the files FindFilesRecursive finds
+func findFiles(pathToScan string, filter Filter) []Full {
+	files, _ := FindFilesRecursive(pathToScan, filter)
+	return files
+}
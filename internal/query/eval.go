@@ -0,0 +1,394 @@
+package query
+
+import (
+	"fmt"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/trie"
+	"regexp"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+type Options struct {
+	CaseSensitive bool
+	// evaluate the query against whole files, rather than single lines, e.g. "retry AND timeout" then matches files
+	// that have both words, on any line
+	PerFile bool
+	// order hits by path and line number, rather than by relevance
+	PathOrder bool
+	// the directory that was indexed; path: terms do not match the directories it is in
+	Root string
+}
+
+// Hit is a line that matches a query, or a file, with LineNumber 0, that matches name: or path: terms without any line
+// matching the other terms
+type Hit struct {
+	fullfileinfo.Full
+	LineNumber int32
+	// the terms, that are not excluded with NOT, found on the line
+	Matches []MatchedTerm
+	// the regular expressions, that are not excluded with NOT, that match the line
+	Patterns []*regexp.Regexp
+	// how relevant the hit is, higher is more relevant; not set when ordering by path
+	Score float64
+}
+
+type MatchedTerm struct {
+	Term         Term
+	TerminalNode *trie.TerminalNode
+	// the number of edits between a fuzzy term and the word on the line; 0 otherwise
+	Distance int
+}
+
+// FuzzyWords returns the distinct words on the line that matched the fuzzy terms of the query
+func (hit Hit) FuzzyWords() []string {
+	var result []string
+	seen := make(map[string]struct{})
+	for _, matched := range hit.Matches {
+		if matched.Term.Fuzzy == 0 {
+			continue
+		}
+		for _, occurrence := range matched.TerminalNode.Occurrences {
+			if _, exists := seen[occurrence.Word]; !exists {
+				seen[occurrence.Word] = struct{}{}
+				result = append(result, occurrence.Word)
+			}
+		}
+	}
+	return result
+}
+
+// Distance returns the number of edits between the fuzzy terms of the query and the words on the line, the closest
+// word counting for each term
+func (hit Hit) Distance() int {
+	fuzzy := false
+	for _, matched := range hit.Matches {
+		fuzzy = fuzzy || matched.Distance > 0
+	}
+	if !fuzzy {
+		return 0
+	}
+
+	closest := make(map[Term]int)
+	for _, matched := range hit.Matches {
+		if distance, exists := closest[matched.Term]; !exists || matched.Distance < distance {
+			closest[matched.Term] = matched.Distance
+		}
+	}
+
+	result := 0
+	for _, distance := range closest {
+		result += distance
+	}
+	return result
+}
+
+// Column returns the byte offset, from 0, of the first word on the line that a term of the query matches, or -1 when
+// only regular expressions matched. With caseSensitive, only words with the same case as the term count.
+func (hit Hit) Column(caseSensitive bool) int32 {
+	result := int32(-1)
+	for _, matched := range hit.Matches {
+		for _, occurrence := range matched.TerminalNode.Occurrences {
+			if matched.Term.Fuzzy == 0 && !occurrence.Matches(matched.Term.Text, matched.Term.Match, caseSensitive) {
+				continue
+			}
+			if result < 0 || occurrence.Column < result {
+				result = occurrence.Column
+			}
+		}
+	}
+	return result
+}
+
+type key struct {
+	fullPath   string
+	lineNumber int32
+}
+
+// the lines a part of the query matches: keys are lines, or files (with lineNumber 0) when evaluating per file.
+// When files is set instead, the set holds every line of those files.
+type keySet struct {
+	keys  map[key]struct{}
+	files map[string]struct{}
+}
+
+// matcher returns whether a line, or a file (with lineNumber 0), matches a part of the query
+type matcher func(lineKey key) bool
+
+type evaluator struct {
+	index   *trie.Trie
+	options Options
+	hits    map[key]*Hit
+}
+
+// Evaluate returns the lines that match expr, the most relevant first: lines with more of the terms, in files with more
+// occurrences of them, or with them in the file name, and in recently modified files. Equally relevant hits are ordered
+// by path and line number. With PathOrder, hits are ordered by distance to any fuzzy terms, and then path and line
+// number.
+// When evaluating per file, these are the lines of the matching files, that have any of the terms that are not excluded.
+func Evaluate(expr Expr, index *trie.Trie, options Options) ([]Hit, error) {
+	e := evaluator{
+		index:   index,
+		options: options,
+		hits:    make(map[key]*Hit),
+	}
+
+	matches, err := e.eval(expr, false)
+	if err != nil {
+		return nil, err
+	}
+
+	linesMatched := make(map[string]struct{})
+	for lineKey := range e.hits {
+		if lineKey.lineNumber > 0 && matches(lineKey) {
+			linesMatched[lineKey.fullPath] = struct{}{}
+		}
+	}
+
+	var result []Hit
+	for lineKey, hit := range e.hits {
+		if !matches(lineKey) {
+			continue
+		}
+		if _, exists := linesMatched[lineKey.fullPath]; exists && lineKey.lineNumber == 0 {
+			// the lines of the file are listed, rather than the file itself
+			continue
+		}
+		result = append(result, *hit)
+	}
+
+	if options.PathOrder {
+		sort.Slice(result, func(i, j int) bool {
+			if result[i].Distance() != result[j].Distance() {
+				return result[i].Distance() < result[j].Distance()
+			}
+			return inPathOrder(result[i], result[j])
+		})
+	} else {
+		rank(result, time.Now())
+	}
+
+	return result, nil
+}
+
+func (e *evaluator) keyFor(fullPath string, lineNumber int32) key {
+	if e.options.PerFile {
+		return key{fullPath, 0}
+	}
+	return key{fullPath, lineNumber}
+}
+
+// excluded is whether expr is below an odd number of NOTs, the lines of its terms are then not reported as hits
+func (e *evaluator) eval(expr Expr, excluded bool) (matcher, error) {
+	switch x := expr.(type) {
+	case termExpr:
+		return e.matcherFor(e.evalTerm(x.term, excluded))
+	case phraseExpr:
+		return e.matcherFor(e.evalPhrase(x.terms, excluded))
+	case regexExpr:
+		return e.matcherFor(e.evalRegex(x.pattern, excluded))
+	case fieldExpr:
+		return e.matcherFor(e.evalField(x, excluded))
+	case notExpr:
+		matches, err := e.eval(x.expr, !excluded)
+		if err != nil {
+			return nil, err
+		}
+		return func(lineKey key) bool {
+			return !matches(lineKey)
+		}, nil
+	case andExpr:
+		leftMatches, rightMatches, err := e.evalBoth(x.left, x.right, excluded)
+		if err != nil {
+			return nil, err
+		}
+		return func(lineKey key) bool {
+			return leftMatches(lineKey) && rightMatches(lineKey)
+		}, nil
+	case orExpr:
+		leftMatches, rightMatches, err := e.evalBoth(x.left, x.right, excluded)
+		if err != nil {
+			return nil, err
+		}
+		return func(lineKey key) bool {
+			return leftMatches(lineKey) || rightMatches(lineKey)
+		}, nil
+	}
+	return func(lineKey key) bool {
+		return false
+	}, nil
+}
+
+func (e *evaluator) evalBoth(left Expr, right Expr, excluded bool) (matcher, matcher, error) {
+	leftMatches, err := e.eval(left, excluded)
+	if err != nil {
+		return nil, nil, err
+	}
+	rightMatches, err := e.eval(right, excluded)
+	if err != nil {
+		return nil, nil, err
+	}
+	return leftMatches, rightMatches, nil
+}
+
+func (e *evaluator) matcherFor(set keySet, err error) (matcher, error) {
+	if err != nil {
+		return nil, err
+	}
+	if set.files != nil {
+		return func(lineKey key) bool {
+			_, exists := set.files[lineKey.fullPath]
+			return exists
+		}, nil
+	}
+	return func(lineKey key) bool {
+		_, exists := set.keys[e.keyFor(lineKey.fullPath, lineKey.lineNumber)]
+		return exists
+	}, nil
+}
+
+func (e *evaluator) evalTerm(term Term, excluded bool) (keySet, error) {
+	if term.Fuzzy > 0 {
+		return e.evalFuzzyTerm(term, excluded)
+	}
+
+	terminalNodes, err := e.index.Find(term.Text, term.Match, e.options.CaseSensitive)
+	if err != nil {
+		return keySet{}, err
+	}
+
+	result := keySet{keys: make(map[key]struct{})}
+	for _, terminalNode := range terminalNodes {
+		result.keys[e.keyFor(terminalNode.FullPath(), terminalNode.LineNumber)] = struct{}{}
+
+		if !excluded {
+			e.addHit(MatchedTerm{Term: term, TerminalNode: terminalNode})
+		}
+	}
+
+	return result, nil
+}
+
+func (e *evaluator) evalFuzzyTerm(term Term, excluded bool) (keySet, error) {
+	fuzzyMatches, err := e.index.FindFuzzy(term.Text, term.Fuzzy, e.options.CaseSensitive)
+	if err != nil {
+		return keySet{}, err
+	}
+
+	result := keySet{keys: make(map[key]struct{})}
+	for _, fuzzyMatch := range fuzzyMatches {
+		result.keys[e.keyFor(fuzzyMatch.FullPath(), fuzzyMatch.LineNumber)] = struct{}{}
+
+		if !excluded {
+			e.addHit(MatchedTerm{Term: term, TerminalNode: fuzzyMatch.TerminalNode, Distance: fuzzyMatch.Distance})
+		}
+	}
+
+	return result, nil
+}
+
+// evalPhrase matches the lines on which the terms are consecutive words, using the position of each word on its line.
+// Words that are too short to be indexed can not be looked up, these match any word at their position.
+func (e *evaluator) evalPhrase(terms []Term, excluded bool) (keySet, error) {
+	// per line, the positions at which the phrase may start, given the terms looked up so far
+	var starts map[key]map[int32]struct{}
+	found := make([][]*trie.TerminalNode, len(terms))
+
+	for idx, term := range terms {
+		if int32(utf8.RuneCountInString(term.Text)) < e.index.MinWordLength() {
+			continue
+		}
+
+		terminalNodes, err := e.index.Find(term.Text, term.Match, e.options.CaseSensitive)
+		if err != nil {
+			return keySet{}, err
+		}
+		found[idx] = terminalNodes
+
+		termStarts := make(map[key]map[int32]struct{})
+		for _, terminalNode := range terminalNodes {
+			lineKey := key{terminalNode.FullPath(), terminalNode.LineNumber}
+			for _, occurrence := range terminalNode.Occurrences {
+				if !occurrence.Matches(term.Text, term.Match, e.options.CaseSensitive) {
+					continue
+				}
+				start := occurrence.Position - int32(idx)
+				if start < 0 {
+					continue
+				}
+				if starts != nil {
+					if _, possible := starts[lineKey][start]; !possible {
+						continue
+					}
+				}
+				if termStarts[lineKey] == nil {
+					termStarts[lineKey] = make(map[int32]struct{})
+				}
+				termStarts[lineKey][start] = struct{}{}
+			}
+		}
+		starts = termStarts
+	}
+
+	if starts == nil {
+		return keySet{}, fmt.Errorf("a phrase needs at least one word of %v characters", e.index.MinWordLength())
+	}
+
+	result := keySet{keys: make(map[key]struct{})}
+	for lineKey := range starts {
+		result.keys[e.keyFor(lineKey.fullPath, lineKey.lineNumber)] = struct{}{}
+	}
+
+	if !excluded {
+		for idx, terminalNodes := range found {
+			for _, terminalNode := range terminalNodes {
+				if _, matches := starts[key{terminalNode.FullPath(), terminalNode.LineNumber}]; matches {
+					e.addHit(MatchedTerm{Term: terms[idx], TerminalNode: terminalNode})
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// evalField matches every line of the files with a name, or directory, that matches the pattern of x
+func (e *evaluator) evalField(x fieldExpr, excluded bool) (keySet, error) {
+	fullPaths, err := e.index.FindPaths(x.pattern, x.field, e.options.CaseSensitive, e.options.Root)
+	if err != nil {
+		return keySet{}, fmt.Errorf("invalid pattern in %v: %v", x, err)
+	}
+
+	result := keySet{files: make(map[string]struct{}, len(fullPaths))}
+	for _, fullPath := range fullPaths {
+		file, exists := e.index.File(fullPath)
+		if !exists {
+			// removed, e.g. by a watched change, since the paths were found
+			continue
+		}
+		result.files[fullPath] = struct{}{}
+
+		if !excluded {
+			fileKey := key{fullPath, 0}
+			if _, exists := e.hits[fileKey]; !exists {
+				e.hits[fileKey] = &Hit{Full: file}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (e *evaluator) addHit(matched MatchedTerm) {
+	lineKey := key{matched.TerminalNode.FullPath(), matched.TerminalNode.LineNumber}
+	hit, exists := e.hits[lineKey]
+	if !exists {
+		hit = &Hit{
+			Full:       matched.TerminalNode.Full,
+			LineNumber: matched.TerminalNode.LineNumber,
+		}
+		e.hits[lineKey] = hit
+	}
+	hit.Matches = append(hit.Matches, matched)
+}
@@ -0,0 +1,506 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/trie"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Term is a single search term of a query
+type Term struct {
+	// the term without its wildcards
+	Text  string
+	Match trie.Match
+	// the number of edits a word may be away from the term, for a fuzzy term; 0 otherwise
+	Fuzzy int
+}
+
+// Expr is a parsed query: a term, or terms combined with AND, OR and NOT
+type Expr interface {
+	String() string
+}
+
+type termExpr struct {
+	term Term
+}
+
+type andExpr struct {
+	left  Expr
+	right Expr
+}
+
+type orExpr struct {
+	left  Expr
+	right Expr
+}
+
+type notExpr struct {
+	expr Expr
+}
+
+// fieldExpr matches the files with a name, or directory, that matches pattern
+type fieldExpr struct {
+	field   trie.Field
+	pattern string
+}
+
+// phraseExpr matches lines that have its terms as consecutive words, in order
+type phraseExpr struct {
+	terms []Term
+}
+
+func (e termExpr) String() string {
+	return e.term.String()
+}
+
+func (t Term) String() string {
+	if t.Fuzzy > 0 {
+		return fmt.Sprintf("%v~%v", t.Text, t.Fuzzy)
+	}
+	switch t.Match {
+	case trie.MatchPrefix:
+		return t.Text + "*"
+	case trie.MatchSuffix:
+		return "*" + t.Text
+	case trie.MatchInfix:
+		return "*" + t.Text + "*"
+	default:
+		return t.Text
+	}
+}
+
+func (e fieldExpr) String() string {
+	if e.field == trie.FieldName {
+		return fieldName + e.pattern
+	}
+	return fieldPath + e.pattern
+}
+
+func (e phraseExpr) String() string {
+	words := make([]string, len(e.terms))
+	for idx, term := range e.terms {
+		words[idx] = term.String()
+	}
+	return `"` + strings.Join(words, " ") + `"`
+}
+
+func (e andExpr) String() string {
+	return "(" + e.left.String() + " AND " + e.right.String() + ")"
+}
+
+func (e orExpr) String() string {
+	return "(" + e.left.String() + " OR " + e.right.String() + ")"
+}
+
+func (e notExpr) String() string {
+	return "NOT " + e.expr.String()
+}
+
+// prefixes of terms that match file names and paths, rather than content
+const (
+	fieldName = "name:"
+	fieldPath = "path:"
+)
+
+const (
+	operatorAnd = "AND"
+	operatorOr  = "OR"
+	operatorNot = "NOT"
+)
+
+// Parse parses a query such as: retry AND timeout NOT test
+//
+// Terms next to each other, without an operator, must both match, i.e. "retry timeout" is "retry AND timeout".
+// "a NOT b" is "a AND NOT b". AND binds tighter than OR, and parentheses group.
+// Each term is matched as a whole word, unless it has wildcards: term* by prefix, *term by suffix, *term* anywhere in a
+// word. A term with a ~, e.g. ~recieve or recieve~2, is fuzzy: it matches words that are up to that many edits away.
+// name:pattern matches files by name, and path:pattern by name or by the directories they are in; pattern has either
+// wildcards, e.g. name:*.go, or is part of the name, e.g. path:gateway.
+// Quoted words, such as "connection refused", are a phrase: the words must follow each other on a line, in order.
+// A regular expression between slashes, such as /err(or)?\s+\d+/, matches the lines it finds a match in.
+func Parse(input string) (Expr, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("expected a search term as input")
+	}
+
+	p := parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %v", p.tokens[p.pos])
+	}
+	if onlyExcludes(expr) {
+		return nil, errors.New("a query needs at least one term that is not excluded with NOT")
+	}
+
+	return expr, nil
+}
+
+// token is an operator, a parenthesis, a term, the text between quotes, or a regular expression between slashes
+type token struct {
+	text   string
+	quoted bool
+	regex  bool
+}
+
+func (t token) String() string {
+	if t.quoted {
+		return `"` + t.text + `"`
+	}
+	if t.regex {
+		return "/" + t.text + "/"
+	}
+	return t.text
+}
+
+// return whether the token is the given operator or parenthesis, which a quoted token or regular expression never is
+func (t token) is(text string) bool {
+	return !t.quoted && !t.regex && t.text == text
+}
+
+func tokenize(input string) ([]token, error) {
+	var result []token
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			result = append(result, token{text: current.String()})
+			current.Reset()
+		}
+	}
+
+	inQuotes := false
+	// the end of the regular expression that was just read
+	skipUntil := 0
+	for idx, c := range input {
+		if idx < skipUntil {
+			continue
+		}
+		if inQuotes {
+			if c == '"' {
+				result = append(result, token{text: current.String(), quoted: true})
+				current.Reset()
+				inQuotes = false
+			} else {
+				current.WriteRune(c)
+			}
+		} else if c == '"' {
+			flush()
+			inQuotes = true
+		} else if c == '/' && current.Len() == 0 {
+			end := regexEnd(input[idx+1:])
+			if end < 0 {
+				return nil, errors.New("missing closing / of the regular expression")
+			}
+			result = append(result, token{text: input[idx+1 : idx+1+end], regex: true})
+			skipUntil = idx + 1 + end + 1
+		} else if c == '(' || c == ')' {
+			flush()
+			result = append(result, token{text: string(c)})
+		} else if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			flush()
+		} else {
+			current.WriteRune(c)
+		}
+	}
+	if inQuotes {
+		return nil, errors.New(`missing closing "`)
+	}
+	flush()
+
+	return result, nil
+}
+
+// Fields splits input at the whitespace Parse splits terms at, but keeps the text between quotes, and a regular
+// expression between slashes, unchanged in the field it is part of, so that the flags of a query typed in, e.g. -A 2, can
+// be told apart from its terms, e.g. the -A of /x -A y/
+func Fields(input string) []string {
+	var result []string
+	start := -1
+	inQuotes := false
+	// whether a / here would start a regular expression, as it does in tokenize
+	atTermStart := true
+	// the end of the regular expression that was just read
+	skipUntil := 0
+	for idx, c := range input {
+		if idx < skipUntil {
+			continue
+		}
+		if !inQuotes && (c == ' ' || c == '\t' || c == '\n' || c == '\r') {
+			if start >= 0 {
+				result = append(result, input[start:idx])
+				start = -1
+			}
+			atTermStart = true
+			continue
+		}
+		if start < 0 {
+			start = idx
+		}
+		if inQuotes {
+			if c == '"' {
+				inQuotes = false
+				atTermStart = true
+			}
+		} else if c == '"' {
+			inQuotes = true
+		} else if c == '/' && atTermStart {
+			end := regexEnd(input[idx+1:])
+			if end < 0 {
+				// the rest is one field, which Parse reports the missing / of
+				break
+			}
+			skipUntil = idx + 1 + end + 1
+		} else {
+			atTermStart = c == '(' || c == ')'
+		}
+	}
+	if start >= 0 {
+		result = append(result, input[start:])
+	}
+
+	return result
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{}
+}
+
+func (p *parser) atEnd() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().is(operatorOr) {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		next := p.peek()
+		if next.is(operatorAnd) {
+			p.pos++
+		} else if p.atEnd() || next.is(operatorOr) || next.is(")") {
+			return left, nil
+		}
+		// an operand that directly follows another is implicitly combined with AND, which includes "a NOT b"
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.atEnd() {
+		if p.pos > 0 {
+			return nil, fmt.Errorf("expected a search term after %v", p.tokens[p.pos-1])
+		}
+		return nil, errors.New("expected a search term as input")
+	}
+
+	token := p.peek()
+	if token.quoted {
+		p.pos++
+		return parsePhrase(token.text)
+	}
+	if token.regex {
+		p.pos++
+		if token.text == "" {
+			return nil, errors.New("expected a regular expression between / and /")
+		}
+		if _, err := compileRegex(token.text, true); err != nil {
+			return nil, err
+		}
+		return regexExpr{token.text}, nil
+	}
+
+	switch token.text {
+	case operatorNot:
+		p.pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr}, nil
+	case "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek().is(")") {
+			return nil, errors.New("missing )")
+		}
+		p.pos++
+		return expr, nil
+	case ")", operatorAnd, operatorOr:
+		if p.pos > 0 {
+			return nil, fmt.Errorf("unexpected %v after %v", token, p.tokens[p.pos-1])
+		}
+		return nil, fmt.Errorf("unexpected %v at the start of the query", token)
+	}
+
+	p.pos++
+	if strings.HasPrefix(token.text, fieldName) || strings.HasPrefix(token.text, fieldPath) {
+		return parseField(token.text)
+	}
+	term, err := parseTerm(token.text)
+	if err != nil {
+		return nil, err
+	}
+	return termExpr{term}, nil
+}
+
+func parseField(text string) (Expr, error) {
+	field, prefix := trie.FieldName, fieldName
+	if strings.HasPrefix(text, fieldPath) {
+		field, prefix = trie.FieldPath, fieldPath
+	}
+	pattern := text[len(prefix):]
+	if pattern == "" {
+		return nil, fmt.Errorf("expected a pattern after %v", text)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern in %v: %v", text, err)
+	}
+	return fieldExpr{field, pattern}, nil
+}
+
+// parsePhrase splits text into its words, the same way lines are split into words when indexed.
+// Words may have wildcards; a phrase of a single word is just that term.
+func parsePhrase(text string) (Expr, error) {
+	words := strings.FieldsFunc(text, func(c rune) bool {
+		return !trie.IsWordRune(c) && c != '*'
+	})
+	if len(words) == 0 {
+		return nil, fmt.Errorf("expected words in the phrase \"%v\"", text)
+	}
+
+	terms := make([]Term, len(words))
+	for idx, word := range words {
+		term, err := parseTerm(word)
+		if err != nil {
+			return nil, err
+		}
+		terms[idx] = term
+	}
+
+	if len(terms) == 1 {
+		return termExpr{terms[0]}, nil
+	}
+	return phraseExpr{terms}, nil
+}
+
+const maxFuzzyDistance = 3
+
+// parseTerm strips the wildcards, or fuzzy marks, from text, which decide how the term is matched
+func parseTerm(text string) (Term, error) {
+	if strings.Contains(text, "~") {
+		return parseFuzzyTerm(text)
+	}
+
+	startsWithWildcard := strings.HasPrefix(text, "*")
+	text = strings.TrimPrefix(text, "*")
+	endsWithWildcard := strings.HasSuffix(text, "*")
+	text = strings.TrimSuffix(text, "*")
+
+	if text == "" {
+		return Term{}, errors.New("expected a search term, not just *")
+	}
+
+	match := trie.MatchWord
+	if startsWithWildcard && endsWithWildcard {
+		match = trie.MatchInfix
+	} else if startsWithWildcard {
+		match = trie.MatchSuffix
+	} else if endsWithWildcard {
+		match = trie.MatchPrefix
+	}
+
+	return Term{Text: text, Match: match}, nil
+}
+
+// parseFuzzyTerm parses ~term, term~ or term~n. Without n, the number of edits depends on the length of the term.
+func parseFuzzyTerm(text string) (Term, error) {
+	text = strings.TrimPrefix(text, "~")
+	distance := 0
+	if idx := strings.LastIndex(text, "~"); idx >= 0 {
+		if idx+1 < len(text) {
+			parsed, err := strconv.Atoi(text[idx+1:])
+			if err != nil || parsed < 1 || parsed > maxFuzzyDistance {
+				return Term{}, fmt.Errorf("expected 1 to %v edits after ~, in %v", maxFuzzyDistance, text)
+			}
+			distance = parsed
+		}
+		text = text[:idx]
+	}
+
+	if text == "" {
+		return Term{}, errors.New("expected a search term, not just ~")
+	}
+	if strings.ContainsAny(text, "*~") {
+		return Term{}, fmt.Errorf("a fuzzy term can not have wildcards: %v", text)
+	}
+
+	if distance == 0 {
+		// a single edit already changes a short word a lot
+		distance = 1
+		if utf8.RuneCountInString(text) > 5 {
+			distance = 2
+		}
+	}
+
+	return Term{Text: text, Match: trie.MatchWord, Fuzzy: distance}, nil
+}
+
+// return whether expr can only exclude lines, e.g. "NOT test", which has nothing to exclude them from
+func onlyExcludes(expr Expr) bool {
+	switch e := expr.(type) {
+	case notExpr:
+		return !onlyExcludes(e.expr)
+	case andExpr:
+		return onlyExcludes(e.left) && onlyExcludes(e.right)
+	case orExpr:
+		return onlyExcludes(e.left) || onlyExcludes(e.right)
+	default:
+		return false
+	}
+}
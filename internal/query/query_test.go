@@ -0,0 +1,393 @@
+package query
+
+import (
+	"fmt"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/trie"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]string{
+		"retry":                           "retry",
+		"retry*":                          "retry*",
+		"*handler":                        "*handler",
+		"*cache*":                         "*cache*",
+		"retry timeout":                   "(retry AND timeout)",
+		"retry AND timeout NOT test":      "((retry AND timeout) AND NOT test)",
+		"retry OR timeout AND test":       "(retry OR (timeout AND test))",
+		"(retry OR timeout) AND test":     "((retry OR timeout) AND test)",
+		"retry AND NOT (test OR mock)":    "(retry AND NOT (test OR mock))",
+		"NOT NOT retry":                   "NOT NOT retry",
+		"  retry   AND\ttimeout ":         "(retry AND timeout)",
+		"(retry)":                         "retry",
+		"retry NOT test NOT mock OR foo":  "(((retry AND NOT test) AND NOT mock) OR foo)",
+		`"connection refused"`:            `"connection refused"`,
+		`"connection: refus*" NOT test`:   `("connection refus*" AND NOT test)`,
+		`"AND"`:                           "AND",
+		`retry"with timeout"`:             `(retry AND "with timeout")`,
+		`/err(or)?\s+\d+/`:                `/err(or)?\s+\d+/`,
+		`/a b\/c/ NOT test`:               `(/a b\/c/ AND NOT test)`,
+		`path/to`:                         "path/to",
+		"~recieve":                        "recieve~2",
+		"~recv":                           "recv~1",
+		"recieve~3 AND ~adress~1":         "(recieve~3 AND adress~1)",
+		"recieve~":                        "recieve~2",
+		"retry name:*.go NOT path:vendor": "((retry AND name:*.go) AND NOT path:vendor)",
+	}
+
+	for input, expected := range tests {
+		expr, err := Parse(input)
+		assert.Nil(t, err, input)
+		if err == nil {
+			assert.Equal(t, expected, expr.String(), input)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"":                    "expected a search term as input",
+		"retry AND":           "expected a search term after AND",
+		"AND retry":           "unexpected AND at the start of the query",
+		"retry OR OR timeout": "unexpected OR after OR",
+		"(retry":              "missing )",
+		"retry)":              "unexpected )",
+		"NOT test":            "a query needs at least one term that is not excluded with NOT",
+		"retry OR NOT test":   "a query needs at least one term that is not excluded with NOT",
+		"*":                   "expected a search term, not just *",
+		`"connection refused`: `missing closing "`,
+		`retry " "`:           `expected words in the phrase " "`,
+		"/retry":              "missing closing / of the regular expression",
+		"recieve~4":           "expected 1 to 3 edits after ~, in recieve~4",
+		"recieve~x":           "expected 1 to 3 edits after ~, in recieve~x",
+		"~rec*":               "a fuzzy term can not have wildcards: rec*",
+		"~":                   "expected a search term, not just ~",
+		"name:":               "expected a pattern after name:",
+		"path:[":              "invalid pattern in path:[: syntax error in pattern",
+		"//":                  "expected a regular expression between / and /",
+		"/retry(/":            "invalid regular expression /retry(/: error parsing regexp: missing closing ): `retry(`",
+	}
+
+	for input, expected := range tests {
+		_, err := Parse(input)
+		if assert.NotNil(t, err, input) {
+			assert.Equal(t, expected, err.Error(), input)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	assert.Equal(t, []string{"-A", "2", "retry", "timeout"}, Fields("-A 2  retry\ttimeout\n"))
+	assert.Equal(t, []string{"/foo  bar/", "-C"}, Fields("/foo  bar/ -C"))
+	assert.Equal(t, []string{"/x -A y/"}, Fields("/x -A y/"))
+	assert.Equal(t, []string{`"connection -refused"`, "-F"}, Fields(`"connection -refused" -F`))
+	assert.Equal(t, []string{`(/a b/)`, "path/to", `a"b c"`}, Fields(`(/a b/) path/to a"b c"`))
+	assert.Equal(t, []string{"/a b"}, Fields("/a b"))
+	assert.Equal(t, 0, len(Fields(" \n")))
+}
+
+func TestEvaluate(t *testing.T) {
+	index := createIndex(t, map[string]string{
+		"a.go": "retry with timeout\n" +
+			"retry only\n" +
+			"timeout only\n" +
+			"retry timeout test\n",
+		"b.go": "retry here\n" +
+			"and a timeout there\n",
+		"b_test.go": "retry timeout\n" +
+			"test\n",
+	})
+
+	tests := map[string][]string{
+		"retry":                               {"a.go:1", "a.go:2", "a.go:4", "b.go:1", "b_test.go:1"},
+		"retry timeout":                       {"a.go:1", "a.go:4", "b_test.go:1"},
+		"retry AND timeout NOT test":          {"a.go:1", "b_test.go:1"},
+		"retry OR timeout":                    {"a.go:1", "a.go:2", "a.go:3", "a.go:4", "b.go:1", "b.go:2", "b_test.go:1"},
+		"timeout NOT retry":                   {"a.go:3", "b.go:2"},
+		"(only OR here) AND NOT timeout":      {"a.go:2", "b.go:1"},
+		"retry NOT (timeout OR only)":         {"b.go:1"},
+		"tim* NOT (retry OR *ere)":            {"a.go:3"},
+		"NOT (NOT retry OR timeout)":          {"a.go:2", "b.go:1"},
+		"missing":                             nil,
+		"retry AND missing":                   nil,
+		"retry AND timeout AND test AND *out": {"a.go:4"},
+	}
+
+	for input, expected := range tests {
+		expr, err := Parse(input)
+		assert.Nil(t, err, input)
+		hits, err := Evaluate(expr, index, Options{PathOrder: true})
+		assert.Nil(t, err, input)
+		assert.Equal(t, expected, locations(hits), input)
+	}
+}
+
+func TestEvaluatePerFile(t *testing.T) {
+	index := createIndex(t, map[string]string{
+		"a.go":      "retry\ntimeout\n",
+		"b.go":      "retry\nother\n",
+		"b_test.go": "retry\ntimeout\ntest\n",
+	})
+
+	expr, _ := Parse("retry AND timeout NOT test")
+	hits, _ := Evaluate(expr, index, Options{PerFile: true, PathOrder: true})
+	assert.Equal(t, []string{"a.go:1", "a.go:2"}, locations(hits))
+
+	// at line granularity, no single line has both
+	hits, _ = Evaluate(expr, index, Options{PathOrder: true})
+	assert.Nil(t, locations(hits))
+
+	// the lines reported are those of the terms that are not excluded
+	expr, _ = Parse("retry NOT timeout")
+	hits, _ = Evaluate(expr, index, Options{PerFile: true, PathOrder: true})
+	assert.Equal(t, []string{"b.go:1"}, locations(hits))
+	assert.Equal(t, "retry", hits[0].Matches[0].Term.Text)
+}
+
+func TestEvaluateCaseSensitive(t *testing.T) {
+	index := createIndex(t, map[string]string{
+		"a.go": "type Config struct\nconfig := load()\n",
+	})
+
+	expr, _ := Parse("Config")
+	hits, _ := Evaluate(expr, index, Options{CaseSensitive: true, PathOrder: true})
+	assert.Equal(t, []string{"a.go:1"}, locations(hits))
+
+	hits, _ = Evaluate(expr, index, Options{PathOrder: true})
+	assert.Equal(t, []string{"a.go:1", "a.go:2"}, locations(hits))
+}
+
+func TestHitColumn(t *testing.T) {
+	index := createIndex(t, map[string]string{
+		"a.go": "config := Config{} // timeout\n",
+	})
+
+	expr, _ := Parse("Config OR timeout")
+	hits, _ := Evaluate(expr, index, Options{CaseSensitive: true})
+	assert.Equal(t, int32(10), hits[0].Column(true))
+
+	hits, _ = Evaluate(expr, index, Options{})
+	assert.Equal(t, int32(0), hits[0].Column(false))
+
+	expr, _ = Parse("/time\\w+/")
+	hits, _ = Evaluate(expr, index, Options{})
+	assert.Equal(t, int32(-1), hits[0].Column(false))
+}
+
+func TestEvaluatePhrase(t *testing.T) {
+	index := createIndex(t, map[string]string{
+		"a.go": "dial: connection refused\n" +
+			"refused connection\n" +
+			"connection was refused\n" +
+			"connection to host refused, connection refused again\n" +
+			"the connection is refused\n",
+	})
+
+	tests := map[string][]string{
+		`"connection refused"`: {"a.go:1", "a.go:4"},
+		`"refused connection"`: {"a.go:2", "a.go:4"},
+		`"connection refus*"`:  {"a.go:1", "a.go:4"},
+		// short words, which are not indexed, match any word at their position
+		`"connection was refused"`:              {"a.go:3", "a.go:5"},
+		`"connection to host refused"`:          {"a.go:4"},
+		`"connection refused" NOT again`:        {"a.go:1"},
+		`"connection refused" OR "was refused"`: {"a.go:1", "a.go:3", "a.go:4", "a.go:5"},
+		`"dial refused"`:                        nil,
+	}
+
+	for input, expected := range tests {
+		expr, err := Parse(input)
+		assert.Nil(t, err, input)
+		hits, err := Evaluate(expr, index, Options{PathOrder: true})
+		assert.Nil(t, err, input)
+		assert.Equal(t, expected, locations(hits), input)
+	}
+
+	// a phrase of words that are too short to be indexed can not be looked up
+	expr, _ := Parse(`"is it"`)
+	_, err := Evaluate(expr, index, Options{PathOrder: true})
+	assert.NotNil(t, err)
+}
+
+func TestEvaluateRegex(t *testing.T) {
+	index := createIndex(t, map[string]string{
+		"a.go": "connection refused after 30 retries\n" +
+			"Connection reset\n" +
+			"connections: 12\n" +
+			"retry 5\n",
+		"b.go": "disconnection refused\n",
+	})
+
+	tests := map[string][]string{
+		`/connection (refused|reset)/`:      {"a.go:1", "a.go:2", "b.go:1"},
+		`/^connection (refused|reset)/`:     {"a.go:1", "a.go:2"},
+		`/\bconnections?:? \d+/`:            {"a.go:3"},
+		`/retr(y|ies)/ NOT refused`:         {"a.go:4"},
+		`/\d\d/`:                            {"a.go:1", "a.go:3"},
+		`/connection\w* refused/ OR /y \d/`: {"a.go:1", "a.go:4", "b.go:1"},
+		`/missing|retry/`:                   {"a.go:4"},
+	}
+
+	for input, expected := range tests {
+		expr, err := Parse(input)
+		assert.Nil(t, err, input)
+		hits, err := Evaluate(expr, index, Options{PathOrder: true})
+		assert.Nil(t, err, input)
+		assert.Equal(t, expected, locations(hits), input)
+	}
+
+	expr, _ := Parse("/Connection/")
+	hits, _ := Evaluate(expr, index, Options{CaseSensitive: true, PathOrder: true})
+	assert.Equal(t, []string{"a.go:2"}, locations(hits))
+	assert.Equal(t, 1, len(hits[0].Patterns))
+}
+
+func TestLiterals(t *testing.T) {
+	tests := map[string]string{
+		`connection`:                   "*connection*",
+		`connection (refused|reset)\d`: "*connection",
+		`^func (\w+) error`:            "(*func AND error*)",
+		`a.b.c`:                        "",
+		`\d+`:                          "",
+		`conn(ection)?\s`:              "*conn*",
+		`(retry|x)`:                    "",
+		`timeout|deadline`:             "(*timeout* OR *deadline*)",
+		`"this.is.quoted"`:             "(this* AND *quoted)",
+	}
+
+	for pattern, expected := range tests {
+		query, err := literals(pattern, false, 4)
+		assert.Nil(t, err, pattern)
+		assert.Equal(t, expected, query.String(), pattern)
+	}
+}
+
+func TestEvaluateFuzzy(t *testing.T) {
+	index := createIndex(t, map[string]string{
+		"a.go": "relieve the pain\n" +
+			"receive a message\n" +
+			"recieve a message\n",
+		"b.go": "did not receive\n" +
+			"unrelated\n",
+	})
+
+	expr, _ := Parse("~recieve")
+	hits, err := Evaluate(expr, index, Options{PathOrder: true})
+	assert.Nil(t, err)
+	// ordered by distance, and then by path and line
+	assert.Equal(t, []string{"a.go:3", "a.go:1", "a.go:2", "b.go:1"}, locations(hits))
+	assert.Equal(t, []int{0, 1, 2, 2}, []int{hits[0].Distance(), hits[1].Distance(), hits[2].Distance(), hits[3].Distance()})
+	assert.Equal(t, []string{"relieve"}, hits[1].FuzzyWords())
+
+	expr, _ = Parse("~recieve AND message NOT ~relief")
+	hits, _ = Evaluate(expr, index, Options{PathOrder: true})
+	assert.Equal(t, []string{"a.go:3", "a.go:2"}, locations(hits))
+	assert.Equal(t, []string{"receive"}, hits[1].FuzzyWords())
+}
+
+func TestRank(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	hit := func(fullPath string, age time.Duration, terms ...string) Hit {
+		fileInfo := fullfileinfo.NewFileInfo(filepath.Base(fullPath), 10, 0644, now.Add(-age))
+		result := Hit{Full: fullfileinfo.NewFull(fileInfo, fullPath), LineNumber: 1}
+		for _, term := range terms {
+			terminalNode := &trie.TerminalNode{Occurrences: []trie.Occurrence{{Word: term}}}
+			result.Matches = append(result.Matches, MatchedTerm{Term: Term{Text: term}, TerminalNode: terminalNode})
+		}
+		return result
+	}
+	year := 365 * 24 * time.Hour
+
+	hits := []Hit{
+		hit("/src/a.go", year, "retry"),
+		hit("/src/retry.go", year, "retry"),
+		hit("/src/b.go", year, "retry", "timeout"),
+		hit("/src/c.go", 0, "retry"),
+		hit("/src/retry/d.go", year, "retry"),
+		hit("/src/e.go", year, "retry"),
+	}
+	// more occurrences in the same file
+	hits = append(hits, hits[5])
+	hits[6].LineNumber = 2
+
+	rank(hits, now)
+
+	// more terms, then the term in the file name, modified recently, in the path, and more often in the file
+	assert.Equal(t, []string{"b.go:1", "retry.go:1", "c.go:1", "d.go:1", "e.go:1", "e.go:2", "a.go:1"}, locations(hits))
+	assert.True(t, hits[0].Score > hits[1].Score)
+	assert.Equal(t, hits[4].Score, hits[5].Score)
+}
+
+func TestEvaluateField(t *testing.T) {
+	index := createIndex(t, map[string]string{
+		"src/payment_gateway.go":   "retry the payment\n",
+		"src/gateway_test.go":      "retry in a test\n",
+		"vendor/gateway/client.go": "retry\n",
+		"docs/retry.md":            "how to retry\n",
+	})
+
+	tests := map[string][]string{
+		// files on their own
+		"name:*.go":                     {"gateway_test.go:0", "payment_gateway.go:0", "client.go:0"},
+		"path:gateway NOT name:*_test*": {"payment_gateway.go:0", "client.go:0"},
+		// the lines of the files, when combined with terms
+		"retry name:*.go NOT path:vendor": {"gateway_test.go:1", "payment_gateway.go:1"},
+		"retry AND path:docs":             {"retry.md:1"},
+		"payment OR name:*.md":            {"retry.md:0", "payment_gateway.go:1"},
+		"retry AND name:*.txt":            nil,
+	}
+
+	for input, expected := range tests {
+		expr, err := Parse(input)
+		assert.Nil(t, err, input)
+		hits, err := Evaluate(expr, index, Options{PathOrder: true})
+		assert.Nil(t, err, input)
+		assert.Equal(t, expected, locations(hits), input)
+	}
+
+	expr, _ := Parse("retry NOT name:*.go")
+	hits, _ := Evaluate(expr, index, Options{PerFile: true, PathOrder: true})
+	assert.Equal(t, []string{"retry.md:1"}, locations(hits))
+}
+
+func TestEvaluateInvalidCharacter(t *testing.T) {
+	index := createIndex(t, map[string]string{"a.go": "retry\n"})
+
+	expr, _ := Parse("retry AND ti-meout")
+	_, err := Evaluate(expr, index, Options{PathOrder: true})
+	assert.NotNil(t, err)
+}
+
+// index files, named by their key with the value as content, in a temporary directory
+func createIndex(t *testing.T, files map[string]string) *trie.Trie {
+	dir := t.TempDir()
+	index := trie.NewTrie(4)
+	for name, content := range files {
+		fullPath := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fileInfo, err := os.Stat(fullPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index.Add(fullfileinfo.NewFull(fileInfo, fullPath))
+	}
+	return index
+}
+
+func locations(hits []Hit) []string {
+	var result []string
+	for _, hit := range hits {
+		result = append(result, fmt.Sprintf("%v:%v", filepath.Base(hit.FullPath()), hit.LineNumber))
+	}
+	return result
+}
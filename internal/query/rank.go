@@ -0,0 +1,102 @@
+package query
+
+import (
+	"github.com/sk-manyways/SearchOutlineLabel/internal/trie"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// weights of what makes a hit relevant
+const (
+	// per distinct term, or regular expression, of the query on the line
+	termsMatchedWeight = 10.0
+	// times the log of how often the terms occur in the file, so that a few more occurrences matter, many more not much
+	fileFrequencyWeight = 2.0
+	// per term that is part of the file name
+	nameMatchWeight = 4.0
+	// per term that is part of the directory the file is in
+	pathMatchWeight = 1.0
+	// for a file modified just now, halving at recencyHalfLife
+	recencyWeight   = 2.0
+	recencyHalfLife = 30 * 24 * time.Hour
+	// per edit between a fuzzy term and the word on the line
+	distanceWeight = 5.0
+)
+
+// rank orders hits by their score, the most relevant first, and then by path and line number
+func rank(hits []Hit, now time.Time) {
+	// how often the terms occur per file, counted over the hits of that file
+	fileFrequency := make(map[string]int)
+	for _, hit := range hits {
+		fileFrequency[hit.FullPath()] += hit.occurrences()
+	}
+
+	for idx := range hits {
+		hits[idx].Score = hits[idx].score(fileFrequency[hits[idx].FullPath()], now)
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return inPathOrder(hits[i], hits[j])
+	})
+}
+
+func inPathOrder(a Hit, b Hit) bool {
+	if a.FullPath() != b.FullPath() {
+		return a.FullPath() < b.FullPath()
+	}
+	return a.LineNumber < b.LineNumber
+}
+
+// return the number of times the terms and regular expressions occur on the line
+func (hit Hit) occurrences() int {
+	result := len(hit.Patterns)
+	for _, matched := range hit.Matches {
+		result += len(matched.TerminalNode.Occurrences)
+	}
+	return result
+}
+
+func (hit Hit) score(fileFrequency int, now time.Time) float64 {
+	name := trie.Fold(hit.Name())
+	directory := trie.Fold(filepath.Dir(hit.FullPath()))
+
+	terms := make(map[Term]struct{})
+	for _, matched := range hit.Matches {
+		terms[matched.Term] = struct{}{}
+	}
+
+	score := termsMatchedWeight*float64(len(terms)+len(hit.Patterns)) +
+		fileFrequencyWeight*math.Log(1+float64(fileFrequency)) -
+		distanceWeight*float64(hit.Distance())
+
+	for term := range terms {
+		text := trie.Fold(term.Text)
+		if strings.Contains(name, text) {
+			score += nameMatchWeight
+		}
+		if strings.Contains(directory, text) {
+			score += pathMatchWeight
+		}
+	}
+	for _, pattern := range hit.Patterns {
+		if pattern.MatchString(hit.Name()) {
+			score += nameMatchWeight
+		}
+	}
+
+	if hit.FileInfo != nil {
+		age := now.Sub(hit.ModTime())
+		if age < 0 {
+			age = 0
+		}
+		score += recencyWeight * math.Pow(0.5, float64(age)/float64(recencyHalfLife))
+	}
+
+	return score
+}
@@ -0,0 +1,334 @@
+package query
+
+import (
+	"fmt"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fileutil"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/trie"
+	"os"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// regexExpr matches the lines that match a regular expression
+type regexExpr struct {
+	pattern string
+}
+
+func (e regexExpr) String() string {
+	return "/" + e.pattern + "/"
+}
+
+type literalOp int
+
+const (
+	// no literal is known, so any line may match
+	literalAll literalOp = iota
+	literalAnd
+	literalOr
+	literalWord
+)
+
+// literalQuery describes the words a line must have to possibly match a regular expression
+type literalQuery struct {
+	op   literalOp
+	subs []literalQuery
+	// for literalWord
+	term          Term
+	caseSensitive bool
+}
+
+var matchAll = literalQuery{op: literalAll}
+
+func (q literalQuery) String() string {
+	switch q.op {
+	case literalWord:
+		return q.term.String()
+	case literalAnd, literalOr:
+		operator := " AND "
+		if q.op == literalOr {
+			operator = " OR "
+		}
+		subs := make([]string, len(q.subs))
+		for idx, sub := range q.subs {
+			subs[idx] = sub.String()
+		}
+		return "(" + strings.Join(subs, operator) + ")"
+	default:
+		return ""
+	}
+}
+
+// compileRegex compiles pattern, which ignores case unless caseSensitive
+func compileRegex(pattern string, caseSensitive bool) (*regexp.Regexp, error) {
+	flags := ""
+	if !caseSensitive {
+		flags = "(?i)"
+	}
+	re, err := regexp.Compile(flags + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression /%v/: %v", pattern, err)
+	}
+	return re, nil
+}
+
+// literals returns the words that a line, that matches pattern, must have, so that candidate lines can be looked up
+// in the trie. Words shorter than minWordLength are not indexed, so are not of use.
+func literals(pattern string, caseSensitive bool, minWordLength int32) (literalQuery, error) {
+	flags := syntax.Perl
+	if !caseSensitive {
+		flags |= syntax.FoldCase
+	}
+	re, err := syntax.Parse(pattern, flags)
+	if err != nil {
+		return matchAll, err
+	}
+	return literalsOf(re.Simplify(), minWordLength), nil
+}
+
+func literalsOf(re *syntax.Regexp, minWordLength int32) literalQuery {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return literalWords(string(re.Rune), re.Flags&syntax.FoldCase == 0, minWordLength)
+	case syntax.OpCapture, syntax.OpPlus:
+		return literalsOf(re.Sub[0], minWordLength)
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return literalsOf(re.Sub[0], minWordLength)
+		}
+		return matchAll
+	case syntax.OpConcat:
+		var subs []literalQuery
+		// adjacent literals are joined, so that words spanning them are found
+		for idx := 0; idx < len(re.Sub); idx++ {
+			sub := re.Sub[idx]
+			if sub.Op == syntax.OpLiteral {
+				text := string(sub.Rune)
+				for idx+1 < len(re.Sub) && re.Sub[idx+1].Op == syntax.OpLiteral &&
+					re.Sub[idx+1].Flags&syntax.FoldCase == sub.Flags&syntax.FoldCase {
+					idx++
+					text += string(re.Sub[idx].Rune)
+				}
+				subs = append(subs, literalWords(text, sub.Flags&syntax.FoldCase == 0, minWordLength))
+			} else {
+				subs = append(subs, literalsOf(sub, minWordLength))
+			}
+		}
+		return literalAndOf(subs)
+	case syntax.OpAlternate:
+		var subs []literalQuery
+		for _, sub := range re.Sub {
+			subQuery := literalsOf(sub, minWordLength)
+			if subQuery.op == literalAll {
+				return matchAll
+			}
+			subs = append(subs, subQuery)
+		}
+		return literalQuery{op: literalOr, subs: subs}
+	default:
+		return matchAll
+	}
+}
+
+// return the words of text, a literal part of a regular expression.
+// The first and last word may continue beyond text, so these are matched by suffix and by prefix.
+func literalWords(text string, caseSensitive bool, minWordLength int32) literalQuery {
+	var subs []literalQuery
+	wordStart := -1
+	addWord := func(end int) {
+		word := text[wordStart:end]
+		if int32(utf8.RuneCountInString(word)) < minWordLength {
+			return
+		}
+		if !caseSensitive {
+			word = trie.Fold(word)
+		}
+		atStart := wordStart == 0
+		atEnd := end == len(text)
+		match := trie.MatchWord
+		if atStart && atEnd {
+			match = trie.MatchInfix
+		} else if atStart {
+			match = trie.MatchSuffix
+		} else if atEnd {
+			match = trie.MatchPrefix
+		}
+		subs = append(subs, literalQuery{op: literalWord, term: Term{Text: word, Match: match}, caseSensitive: caseSensitive})
+	}
+
+	for idx, c := range text {
+		if trie.IsWordRune(c) {
+			if wordStart < 0 {
+				wordStart = idx
+			}
+		} else if wordStart >= 0 {
+			addWord(idx)
+			wordStart = -1
+		}
+	}
+	if wordStart >= 0 {
+		addWord(len(text))
+	}
+
+	return literalAndOf(subs)
+}
+
+func literalAndOf(subs []literalQuery) literalQuery {
+	var known []literalQuery
+	for _, sub := range subs {
+		if sub.op != literalAll {
+			known = append(known, sub)
+		}
+	}
+	switch len(known) {
+	case 0:
+		return matchAll
+	case 1:
+		return known[0]
+	default:
+		return literalQuery{op: literalAnd, subs: known}
+	}
+}
+
+// return the lines that may match the literal query, or false when any line may match
+func (e *evaluator) candidateLines(query literalQuery) (map[key]struct{}, bool, error) {
+	switch query.op {
+	case literalWord:
+		terminalNodes, err := e.index.Find(query.term.Text, query.term.Match, query.caseSensitive)
+		if err != nil {
+			return nil, false, err
+		}
+		result := make(map[key]struct{}, len(terminalNodes))
+		for _, terminalNode := range terminalNodes {
+			result[key{terminalNode.FullPath(), terminalNode.LineNumber}] = struct{}{}
+		}
+		return result, true, nil
+	case literalAnd, literalOr:
+		var result map[key]struct{}
+		for _, sub := range query.subs {
+			lines, known, err := e.candidateLines(sub)
+			if err != nil {
+				return nil, false, err
+			}
+			if !known {
+				if query.op == literalOr {
+					return nil, false, nil
+				}
+				continue
+			}
+			if result == nil {
+				result = lines
+			} else if query.op == literalAnd {
+				for k := range result {
+					if _, exists := lines[k]; !exists {
+						delete(result, k)
+					}
+				}
+			} else {
+				for k := range lines {
+					result[k] = struct{}{}
+				}
+			}
+		}
+		return result, result != nil, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// evalRegex narrows down the lines that may match pattern using the trie, and then reads those lines to check them.
+// Without any words to look up, every line of every indexed file is checked.
+func (e *evaluator) evalRegex(pattern string, excluded bool) (keySet, error) {
+	re, err := compileRegex(pattern, e.options.CaseSensitive)
+	if err != nil {
+		return keySet{}, err
+	}
+	literalQuery, err := literals(pattern, e.options.CaseSensitive, e.index.MinWordLength())
+	if err != nil {
+		return keySet{}, err
+	}
+	candidates, known, err := e.candidateLines(literalQuery)
+	if err != nil {
+		return keySet{}, err
+	}
+
+	files := e.index.Files()
+	var fullPaths []string
+	// per file, the candidate line numbers, in order
+	lineNumbers := make(map[string][]int32)
+	if known {
+		for candidate := range candidates {
+			if _, exists := lineNumbers[candidate.fullPath]; !exists {
+				fullPaths = append(fullPaths, candidate.fullPath)
+			}
+			lineNumbers[candidate.fullPath] = append(lineNumbers[candidate.fullPath], candidate.lineNumber)
+		}
+	} else {
+		for fullPath := range files {
+			fullPaths = append(fullPaths, fullPath)
+		}
+	}
+	sort.Strings(fullPaths)
+
+	result := keySet{keys: make(map[key]struct{})}
+	for _, fullPath := range fullPaths {
+		candidateLineNumbers := lineNumbers[fullPath]
+		sort.Slice(candidateLineNumbers, func(i, j int) bool {
+			return candidateLineNumbers[i] < candidateLineNumbers[j]
+		})
+
+		err := fileutil.ScanLines(fullPath, func(lineNumber int32, line string) bool {
+			if known {
+				if len(candidateLineNumbers) == 0 {
+					return false
+				}
+				if candidateLineNumbers[0] != lineNumber {
+					return true
+				}
+				candidateLineNumbers = candidateLineNumbers[1:]
+			}
+			if !re.MatchString(line) {
+				return true
+			}
+
+			result.keys[e.keyFor(fullPath, lineNumber)] = struct{}{}
+			if !excluded {
+				lineKey := key{fullPath, lineNumber}
+				hit, exists := e.hits[lineKey]
+				if !exists {
+					hit = &Hit{
+						Full:       files[fullPath],
+						LineNumber: lineNumber,
+					}
+					e.hits[lineKey] = hit
+				}
+				hit.Patterns = append(hit.Patterns, re)
+			}
+			return true
+		})
+		if err != nil {
+			// the file may have been removed since it was indexed, which is not worth stopping for
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("Error reading file %v, error: %v", fullPath, err.Error()))
+		}
+	}
+
+	return result, nil
+}
+
+// return the index of the / that ends the regular expression starting at input, or -1 when there is none.
+// A / within the regular expression is escaped as \/, which the regular expression then also reads as /.
+func regexEnd(input string) int {
+	escaped := false
+	for idx, c := range input {
+		if escaped {
+			escaped = false
+		} else if c == '\\' {
+			escaped = true
+		} else if c == '/' {
+			return idx
+		}
+	}
+	return -1
+}
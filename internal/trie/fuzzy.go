@@ -0,0 +1,109 @@
+package trie
+
+import "sort"
+
+// FuzzyMatch is a line with a word that is within the edit distance of a fuzzy search term
+type FuzzyMatch struct {
+	*TerminalNode
+	// the number of runes inserted, deleted or substituted to get from the search term to the word
+	Distance int
+}
+
+// FindFuzzy returns the lines with a word that is at most maxDistance edits away from searchTerm, the closest first.
+// With caseSensitive, a different case counts as an edit, otherwise case is ignored.
+func (trie *Trie) FindFuzzy(searchTerm string, maxDistance int, caseSensitive bool) ([]FuzzyMatch, error) {
+	if err := validateTerm(searchTerm); err != nil {
+		return nil, err
+	}
+	termRunes := []rune(Fold(searchTerm))
+
+	// the distance from the empty word to each prefix of the term
+	row := make([]int, len(termRunes)+1)
+	for idx := range row {
+		row[idx] = idx
+	}
+
+	trie.mu.RLock()
+	var result []FuzzyMatch
+	trie.root.findFuzzy(termRunes, row, maxDistance, func(node *TrieNode, distance int) {
+		for _, terminalNode := range node.terminalNodes {
+			result = append(result, FuzzyMatch{terminalNode, distance})
+		}
+	})
+	trie.mu.RUnlock()
+
+	if caseSensitive {
+		// the folded distance is the least the distance can be, the spellings on the line decide the actual distance
+		caseRunes := []rune(searchTerm)
+		kept := result[:0]
+		for _, fuzzyMatch := range result {
+			distance := -1
+			for _, occurrence := range fuzzyMatch.Occurrences {
+				occurrenceDistance := editDistance([]rune(occurrence.Word), caseRunes)
+				if distance < 0 || occurrenceDistance < distance {
+					distance = occurrenceDistance
+				}
+			}
+			if distance >= 0 && distance <= maxDistance {
+				kept = append(kept, FuzzyMatch{fuzzyMatch.TerminalNode, distance})
+			}
+		}
+		result = kept
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Distance < result[j].Distance
+	})
+
+	return result, nil
+}
+
+// walk the children of node, with row the edit distances from the word at node to each prefix of termRunes, and call
+// onMatch for every word within maxDistance of termRunes. A child is skipped once no prefix is within maxDistance.
+func (node *TrieNode) findFuzzy(termRunes []rune, row []int, maxDistance int, onMatch func(node *TrieNode, distance int)) {
+	for idx, child := range node.children {
+		c := node.childRunes[idx]
+
+		childRow := make([]int, len(row))
+		childRow[0] = row[0] + 1
+		smallest := childRow[0]
+		for i := 1; i < len(row); i++ {
+			substitution := row[i-1]
+			if termRunes[i-1] != c {
+				substitution++
+			}
+			childRow[i] = min(substitution, min(row[i]+1, childRow[i-1]+1))
+			if childRow[i] < smallest {
+				smallest = childRow[i]
+			}
+		}
+
+		if childRow[len(childRow)-1] <= maxDistance && len(child.terminalNodes) > 0 {
+			onMatch(child, childRow[len(childRow)-1])
+		}
+		if smallest <= maxDistance {
+			child.findFuzzy(termRunes, childRow, maxDistance, onMatch)
+		}
+	}
+}
+
+// return the number of runes inserted, deleted or substituted to get from a to b
+func editDistance(a []rune, b []rune) int {
+	row := make([]int, len(b)+1)
+	for idx := range row {
+		row[idx] = idx
+	}
+	for i := 1; i <= len(a); i++ {
+		previous := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			substitution := previous
+			if a[i-1] != b[j-1] {
+				substitution++
+			}
+			previous = row[j]
+			row[j] = min(substitution, min(row[j]+1, row[j-1]+1))
+		}
+	}
+	return row[len(b)]
+}
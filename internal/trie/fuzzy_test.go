@@ -0,0 +1,46 @@
+package trie
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTrie_FindFuzzy(t *testing.T) {
+	trie := NewTrie(4)
+	trie.addLine("receive the message", createDummyFileInfo(), 1, true)
+	trie.addLine("Recieve it", createDummyFileInfo(), 2, true)
+	trie.addLine("relieve and deceive", createDummyFileInfo(), 3, true)
+	trie.addLine("received", createDummyFileInfo(), 4, true)
+
+	result, err := trie.FindFuzzy("recieve", 2, false)
+	assert.Nil(t, err)
+	// closest first; swapping two letters is two edits, so received is three edits away
+	assert.Equal(t, []string{"2:0", "3:1", "1:2"}, fuzzyLocations(result))
+
+	result, _ = trie.FindFuzzy("recieve", 1, false)
+	assert.Equal(t, []string{"2:0", "3:1"}, fuzzyLocations(result))
+
+	// a different case is an edit
+	result, _ = trie.FindFuzzy("recieve", 1, true)
+	assert.Equal(t, []string{"2:1", "3:1"}, fuzzyLocations(result))
+
+	_, err = trie.FindFuzzy("re-cieve", 1, false)
+	assert.NotNil(t, err)
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance([]rune("receive"), []rune("receive")))
+	assert.Equal(t, 2, editDistance([]rune("receive"), []rune("recieve")))
+	assert.Equal(t, 3, editDistance([]rune("kitten"), []rune("sitting")))
+	assert.Equal(t, 4, editDistance([]rune(""), []rune("word")))
+	assert.Equal(t, 1, editDistance([]rune("пробит"), []rune("прибит")))
+}
+
+func fuzzyLocations(fuzzyMatches []FuzzyMatch) []string {
+	var result []string
+	for _, fuzzyMatch := range fuzzyMatches {
+		result = append(result, fmt.Sprintf("%v:%v", fuzzyMatch.LineNumber, fuzzyMatch.Distance))
+	}
+	return result
+}
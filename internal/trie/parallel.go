@@ -0,0 +1,111 @@
+package trie
+
+import "github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
+
+// each worker gets several batches of files, so that a batch with large files does not hold up the other workers
+const batchesPerWorker = 8
+
+// AddAll adds files, with the reading and splitting into words spread over the given number of workers.
+// The result is the same as calling Add for each file, in order.
+func (trie *Trie) AddAll(files []fullfileinfo.Full, workers int) {
+	indexed := trie.index(files, workers)
+
+	trie.mu.Lock()
+	defer trie.mu.Unlock()
+
+	trie.merge(indexed)
+}
+
+// build a new trie, with the same settings as the receiver, holding files; the receiver itself is not touched.
+// Files are split into consecutive batches, each batch is indexed into its own trie, and the batch tries are merged in
+// order, which keeps the terminal nodes in the same order as when adding the files one by one.
+func (trie *Trie) index(files []fullfileinfo.Full, workers int) *Trie {
+	result := NewTrie(trie.minWordLength)
+	if workers <= 1 || len(files) <= 1 {
+		for _, file := range files {
+			result.add(file)
+		}
+		return result
+	}
+
+	batchSize := len(files) / (workers * batchesPerWorker)
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	batchCount := (len(files) + batchSize - 1) / batchSize
+
+	batchResults := make([]chan *Trie, batchCount)
+	for i := range batchResults {
+		batchResults[i] = make(chan *Trie, 1)
+	}
+
+	batches := make(chan int)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for batch := range batches {
+				batchTrie := NewTrie(trie.minWordLength)
+				for _, file := range files[batch*batchSize : min((batch+1)*batchSize, len(files))] {
+					batchTrie.add(file)
+				}
+				batchResults[batch] <- batchTrie
+			}
+		}()
+	}
+
+	go func() {
+		for batch := 0; batch < batchCount; batch++ {
+			batches <- batch
+		}
+		close(batches)
+	}()
+
+	for _, batchResult := range batchResults {
+		result.merge(<-batchResult)
+	}
+
+	return result
+}
+
+// move the content of other into the trie, after what the trie already holds; other may no longer be used afterwards
+func (trie *Trie) merge(other *Trie) {
+	for fullPath, file := range other.files {
+		trie.files[fullPath] = file
+		trie.paths.add(fullPath)
+	}
+	for fullPath := range other.longLines {
+		trie.longLines[fullPath] = struct{}{}
+	}
+	for fullPath := range other.binary {
+		trie.binary[fullPath] = struct{}{}
+	}
+	mergeNode(trie.root, other.root)
+	for word := range other.words.nodes {
+		if _, exists := trie.words.nodes[word]; !exists {
+			trie.words.add(word, trie.root.find(word))
+		}
+	}
+}
+
+func mergeNode(node *TrieNode, other *TrieNode) {
+	// share the spellings the node already has, rather than keeping both copies
+	for _, word := range other.words {
+		if _, exists := node.findWord(word); !exists {
+			node.words = append(node.words, word)
+		}
+	}
+	for _, terminalNode := range other.terminalNodes {
+		for idx, occurrence := range terminalNode.Occurrences {
+			terminalNode.Occurrences[idx].Word, _ = node.findWord(occurrence.Word)
+		}
+	}
+	node.terminalNodes = append(node.terminalNodes, other.terminalNodes...)
+
+	for idx, otherChild := range other.children {
+		r := other.childRunes[idx]
+		if child := node.child(r); child != nil {
+			mergeNode(child, otherChild)
+		} else {
+			node.insertChild(r, otherChild)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package trie
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestTrie_AddAllMatchesSequentialAdd(t *testing.T) {
+	tempDir := t.TempDir()
+	random := rand.New(rand.NewSource(1))
+	words := []string{"alpha", "beta", "gamma", "delta", "epsilon", "under_score", "main", "zeta1", "2023"}
+
+	var fullPaths []string
+	for i := 0; i < 200; i++ {
+		var content strings.Builder
+		lineCount := random.Intn(30)
+		for line := 0; line < lineCount; line++ {
+			wordCount := random.Intn(6)
+			for word := 0; word < wordCount; word++ {
+				content.WriteString(words[random.Intn(len(words))])
+				content.WriteString(" ")
+			}
+			content.WriteString("\n")
+		}
+		fullPaths = append(fullPaths, writeTestFile(t, tempDir, fmt.Sprintf("file%v.txt", i), content.String()))
+	}
+	files := statFiles(t, fullPaths...)
+
+	sequential := NewTrie(4)
+	for _, file := range files {
+		sequential.Add(file)
+	}
+
+	for _, workers := range []int{1, 2, 3, 16} {
+		parallel := NewTrie(4)
+		parallel.AddAll(files, workers)
+
+		assert.Equal(t, len(sequential.Files()), len(parallel.Files()))
+		for _, word := range append(words, "alp", "ep", "z", "2", "lta", "ore") {
+			for _, match := range []Match{MatchWord, MatchPrefix, MatchSuffix, MatchInfix} {
+				expected, _ := sequential.Find(word, match, false)
+				actual, _ := parallel.Find(word, match, false)
+				assert.Equal(t, toLocations(expected), toLocations(actual), "workers %v, word %v", workers, word)
+			}
+		}
+	}
+}
+
+func toLocations(terminalNodes []*TerminalNode) []string {
+	var result []string
+	for _, terminalNode := range terminalNodes {
+		result = append(result, fmt.Sprintf("%v:%v", terminalNode.FullPath(), terminalNode.LineNumber))
+	}
+	return result
+}
@@ -0,0 +1,142 @@
+package trie
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Field is a part of a file's path that can be searched, rather than its content
+type Field int
+
+const (
+	// FieldName is the name of the file
+	FieldName Field = iota
+	// FieldPath is the name of the file, or of any directory it is in
+	FieldPath
+)
+
+// pathIndex holds the (folded) names of the files, and of the directories they are in, with the files that have them
+type pathIndex struct {
+	names       map[string]map[string]struct{}
+	directories map[string]map[string]struct{}
+}
+
+func newPathIndex() *pathIndex {
+	return &pathIndex{
+		names:       make(map[string]map[string]struct{}),
+		directories: make(map[string]map[string]struct{}),
+	}
+}
+
+func (pi *pathIndex) add(fullPath string) {
+	addPath(pi.names, Fold(filepath.Base(fullPath)), fullPath)
+	for _, directory := range directoryNames(fullPath) {
+		addPath(pi.directories, Fold(directory), fullPath)
+	}
+}
+
+func (pi *pathIndex) remove(fullPath string) {
+	removePath(pi.names, Fold(filepath.Base(fullPath)), fullPath)
+	for _, directory := range directoryNames(fullPath) {
+		removePath(pi.directories, Fold(directory), fullPath)
+	}
+}
+
+func addPath(index map[string]map[string]struct{}, name string, fullPath string) {
+	fullPaths, exists := index[name]
+	if !exists {
+		fullPaths = make(map[string]struct{})
+		index[name] = fullPaths
+	}
+	fullPaths[fullPath] = struct{}{}
+}
+
+func removePath(index map[string]map[string]struct{}, name string, fullPath string) {
+	fullPaths := index[name]
+	delete(fullPaths, fullPath)
+	if len(fullPaths) == 0 {
+		delete(index, name)
+	}
+}
+
+// return the names of the directories of fullPath, from the top down
+func directoryNames(fullPath string) []string {
+	var result []string
+	for _, directory := range strings.Split(filepath.ToSlash(filepath.Dir(fullPath)), "/") {
+		if directory != "" && directory != "." && !strings.HasSuffix(directory, ":") {
+			result = append(result, directory)
+		}
+	}
+	return result
+}
+
+// FindPaths returns the full paths of the files, in order, whose name (FieldName), or name or any directory name
+// (FieldPath), matches pattern. A pattern with wildcards (*, ?, or [...]) must match the whole name, as per path.Match;
+// without, it only needs to be part of the name. With caseSensitive, the name must also have the same case as pattern.
+// The directories root is in are not matched, e.g. home in /home/me/root/a.go.
+func (trie *Trie) FindPaths(pattern string, field Field, caseSensitive bool, root string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	isGlob := strings.ContainsAny(pattern, "*?[")
+	matchName := func(name string, pattern string) bool {
+		if isGlob {
+			matched, _ := path.Match(pattern, name)
+			return matched
+		}
+		return strings.Contains(name, pattern)
+	}
+
+	foldedPattern := Fold(pattern)
+	found := make(map[string]struct{})
+	trie.mu.RLock()
+	indexes := []map[string]map[string]struct{}{trie.paths.names}
+	if field == FieldPath {
+		indexes = append(indexes, trie.paths.directories)
+	}
+	for _, index := range indexes {
+		for name, fullPaths := range index {
+			if matchName(name, foldedPattern) {
+				for fullPath := range fullPaths {
+					found[fullPath] = struct{}{}
+				}
+			}
+		}
+	}
+	trie.mu.RUnlock()
+
+	// the index holds folded names, including those of the directories above root, so check the names of each file as
+	// they are
+	verify := caseSensitive || (field == FieldPath && root != "")
+
+	var result []string
+	for fullPath := range found {
+		if verify {
+			names := []string{filepath.Base(fullPath)}
+			if field == FieldPath {
+				relativePath, err := filepath.Rel(root, fullPath)
+				if err != nil || root == "" {
+					relativePath = fullPath
+				}
+				names = append(names, directoryNames(relativePath)...)
+			}
+			matched := false
+			for _, name := range names {
+				if caseSensitive {
+					matched = matched || matchName(name, pattern)
+				} else {
+					matched = matched || matchName(Fold(name), foldedPattern)
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+		result = append(result, fullPath)
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
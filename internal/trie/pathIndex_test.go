@@ -0,0 +1,75 @@
+package trie
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrie_FindPaths(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "Project")
+	trie := NewTrie(4)
+	trie.AddAll(statFiles(t,
+		writeTestFile(t, root, "src/payment_gateway.go", "package src"),
+		writeTestFile(t, root, "src/Gateway/client_test.go", "package gateway"),
+		writeTestFile(t, root, "vendor/lib/README.md", "readme"),
+	), 1)
+
+	relative := func(fullPaths []string) []string {
+		var result []string
+		for _, fullPath := range fullPaths {
+			relativePath, _ := filepath.Rel(root, fullPath)
+			result = append(result, filepath.ToSlash(relativePath))
+		}
+		return result
+	}
+
+	tests := []struct {
+		pattern       string
+		field         Field
+		caseSensitive bool
+		expected      []string
+	}{
+		{"gateway", FieldName, false, []string{"src/payment_gateway.go"}},
+		{"gateway", FieldPath, false, []string{"src/Gateway/client_test.go", "src/payment_gateway.go"}},
+		{"Gateway", FieldPath, true, []string{"src/Gateway/client_test.go"}},
+		{"*.go", FieldName, false, []string{"src/Gateway/client_test.go", "src/payment_gateway.go"}},
+		{"*_test.go", FieldName, false, []string{"src/Gateway/client_test.go"}},
+		{"readme.md", FieldName, false, []string{"vendor/lib/README.md"}},
+		{"readme.md", FieldName, true, nil},
+		{"vendor", FieldPath, false, []string{"vendor/lib/README.md"}},
+		{"vendor", FieldName, false, nil},
+		{"v?ndor", FieldPath, false, []string{"vendor/lib/README.md"}},
+		// the directories root is in are not matched
+		{"project", FieldPath, false, nil},
+	}
+
+	for _, test := range tests {
+		result, err := trie.FindPaths(test.pattern, test.field, test.caseSensitive, root)
+		assert.Nil(t, err, test.pattern)
+		assert.Equal(t, test.expected, relative(result), test.pattern)
+	}
+
+	// without a root, every directory is matched
+	result, _ := trie.FindPaths("project", FieldPath, false, "")
+	assert.Equal(t, 3, len(result))
+
+	_, err := trie.FindPaths("[", FieldName, false, root)
+	assert.NotNil(t, err)
+
+	// removed files are dropped from the path index
+	trie.Remove(map[string]struct{}{filepath.Join(root, "vendor/lib/README.md"): {}})
+	result, _ = trie.FindPaths("vendor", FieldPath, false, root)
+	assert.Nil(t, result)
+	assert.Equal(t, 0, len(trie.paths.directories["vendor"]))
+
+	// and are restored from the file table when loading an index
+	var buf bytes.Buffer
+	assert.Nil(t, trie.save(&buf, root))
+	loaded, err := load(bytes.NewReader(buf.Bytes()), root, 4)
+	assert.Nil(t, err)
+	result, _ = loaded.FindPaths("gateway", FieldPath, false, root)
+	assert.Equal(t, []string{"src/Gateway/client_test.go", "src/payment_gateway.go"}, relative(result))
+}
@@ -0,0 +1,475 @@
+package trie
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// An index file is laid out as:
+// magic, version (uint32), body, crc32 of the body (uint32)
+//
+// The body holds the root that was scanned, the min word length, the file table, the files with long lines, and those
+// that look binary, as positions in the file table, and then the nodes, depth first.
+// Terminal nodes refer to files by their position in the file table.
+
+const indexMagic = "SOLIDX"
+
+const indexVersion = uint32(8)
+
+// upper bound for any single length read from an index file, guards against allocating garbage sizes from a corrupt file
+const maxIndexLength = 1 << 28
+
+var ErrIndexVersion = errors.New("index file has an unsupported version")
+
+var ErrIndexCorrupt = errors.New("index file is corrupt")
+
+var ErrIndexMismatch = errors.New("index file was built with different settings")
+
+func (trie *Trie) SaveFile(fullPath string, root string) error {
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so that an interrupted save never leaves a half written index behind
+	tmpFile, err := os.CreateTemp(filepath.Dir(fullPath), filepath.Base(fullPath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	err = trie.save(tmpFile, root)
+	closeErr := tmpFile.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	return os.Rename(tmpFile.Name(), fullPath)
+}
+
+func LoadFile(fullPath string, root string, minWordLength int32) (*Trie, error) {
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return load(file, root, minWordLength)
+}
+
+func (trie *Trie) save(w io.Writer, root string) error {
+	trie.mu.RLock()
+	defer trie.mu.RUnlock()
+
+	bufWriter := bufio.NewWriter(w)
+	if _, err := bufWriter.WriteString(indexMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(bufWriter, binary.LittleEndian, indexVersion); err != nil {
+		return err
+	}
+
+	iw := newIndexWriter(bufWriter)
+	iw.writeString(root)
+	iw.writeVarint(int64(trie.minWordLength))
+
+	files, fileIdx := trie.fileTable()
+	iw.writeUvarint(uint64(len(files)))
+	for _, file := range files {
+		iw.writeFile(file)
+	}
+
+	iw.writeFileSet(files, trie.longLines)
+	iw.writeFileSet(files, trie.binary)
+
+	iw.writeNode(trie.root, fileIdx)
+
+	if iw.err != nil {
+		return iw.err
+	}
+	if err := binary.Write(bufWriter, binary.LittleEndian, iw.crc.Sum32()); err != nil {
+		return err
+	}
+
+	return bufWriter.Flush()
+}
+
+func load(r io.Reader, root string, minWordLength int32) (*Trie, error) {
+	bufReader := bufio.NewReader(r)
+
+	magic := make([]byte, len(indexMagic))
+	if _, err := io.ReadFull(bufReader, magic); err != nil || string(magic) != indexMagic {
+		return nil, ErrIndexCorrupt
+	}
+	var version uint32
+	if err := binary.Read(bufReader, binary.LittleEndian, &version); err != nil {
+		return nil, ErrIndexCorrupt
+	}
+	if version != indexVersion {
+		return nil, ErrIndexVersion
+	}
+
+	ir := newIndexReader(bufReader)
+	storedRoot := ir.readString()
+	storedMinWordLength := int32(ir.readVarint())
+	if ir.err != nil {
+		return nil, ErrIndexCorrupt
+	}
+	if storedRoot != root || storedMinWordLength != minWordLength {
+		return nil, ErrIndexMismatch
+	}
+
+	result := NewTrie(minWordLength)
+
+	fileCount := ir.readLength()
+	files := make([]fullfileinfo.Full, 0, min(fileCount, 1024))
+	for i := 0; i < fileCount && ir.err == nil; i++ {
+		file := ir.readFile()
+		files = append(files, file)
+		result.files[file.FullPath()] = file
+		result.paths.add(file.FullPath())
+	}
+
+	ir.readFileSet(files, result.longLines)
+	ir.readFileSet(files, result.binary)
+
+	result.root = ir.readNode(files, 0)
+	if ir.err != nil {
+		return nil, ErrIndexCorrupt
+	}
+	result.indexWords(result.root, nil)
+
+	var checksum uint32
+	expectedChecksum := ir.crc.Sum32()
+	if err := binary.Read(bufReader, binary.LittleEndian, &checksum); err != nil || checksum != expectedChecksum {
+		return nil, ErrIndexCorrupt
+	}
+
+	return result, nil
+}
+
+// return the files in a stable order, and the position of each file in that order
+func (trie *Trie) fileTable() ([]fullfileinfo.Full, map[string]uint64) {
+	var files []fullfileinfo.Full
+	for _, file := range trie.files {
+		files = append(files, file)
+	}
+
+	// terminal nodes may refer to files that were never passed to Add, e.g. lines added directly
+	var collect func(node *TrieNode)
+	known := make(map[string]struct{})
+	for path := range trie.files {
+		known[path] = struct{}{}
+	}
+	collect = func(node *TrieNode) {
+		for _, terminalNode := range node.terminalNodes {
+			if _, exists := known[terminalNode.FullPath()]; !exists {
+				known[terminalNode.FullPath()] = struct{}{}
+				files = append(files, terminalNode.Full)
+			}
+		}
+		for _, child := range node.children {
+			collect(child)
+		}
+	}
+	collect(trie.root)
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].FullPath() < files[j].FullPath()
+	})
+
+	fileIdx := make(map[string]uint64, len(files))
+	for idx, file := range files {
+		fileIdx[file.FullPath()] = uint64(idx)
+	}
+
+	return files, fileIdx
+}
+
+// add every word below node, which is reached through the runes of prefix, to the word index
+func (trie *Trie) indexWords(node *TrieNode, prefix []rune) {
+	if len(node.terminalNodes) > 0 {
+		trie.words.add(string(prefix), node)
+	}
+	for idx, child := range node.children {
+		trie.indexWords(child, append(prefix, node.childRunes[idx]))
+	}
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+type indexWriter struct {
+	w   io.Writer
+	crc hash.Hash32
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func newIndexWriter(w io.Writer) *indexWriter {
+	crc := crc32.NewIEEE()
+	return &indexWriter{
+		w:   io.MultiWriter(w, crc),
+		crc: crc,
+	}
+}
+
+func (iw *indexWriter) write(b []byte) {
+	if iw.err != nil {
+		return
+	}
+	_, iw.err = iw.w.Write(b)
+}
+
+func (iw *indexWriter) writeUvarint(v uint64) {
+	n := binary.PutUvarint(iw.buf[:], v)
+	iw.write(iw.buf[:n])
+}
+
+func (iw *indexWriter) writeVarint(v int64) {
+	n := binary.PutVarint(iw.buf[:], v)
+	iw.write(iw.buf[:n])
+}
+
+func (iw *indexWriter) writeString(s string) {
+	iw.writeUvarint(uint64(len(s)))
+	iw.write([]byte(s))
+}
+
+func (iw *indexWriter) writeFile(file fullfileinfo.Full) {
+	iw.writeString(file.FullPath())
+	if file.FileInfo == nil {
+		iw.writeString(filepath.Base(file.FullPath()))
+		iw.writeVarint(0)
+		iw.writeUvarint(0)
+		iw.writeVarint(0)
+		return
+	}
+	iw.writeString(file.Name())
+	iw.writeVarint(file.Size())
+	iw.writeUvarint(uint64(file.Mode()))
+	iw.writeVarint(file.ModTime().UnixNano())
+}
+
+// write the positions, in the file table, of the files in fileSet
+func (iw *indexWriter) writeFileSet(files []fullfileinfo.Full, fileSet map[string]struct{}) {
+	var positions []uint64
+	for idx, file := range files {
+		if _, exists := fileSet[file.FullPath()]; exists {
+			positions = append(positions, uint64(idx))
+		}
+	}
+	iw.writeUvarint(uint64(len(positions)))
+	for _, idx := range positions {
+		iw.writeUvarint(idx)
+	}
+}
+
+func (iw *indexWriter) writeNode(node *TrieNode, fileIdx map[string]uint64) {
+	wordIdx := make(map[string]uint64, len(node.words))
+	iw.writeUvarint(uint64(len(node.words)))
+	for idx, word := range node.words {
+		wordIdx[word] = uint64(idx)
+		iw.writeString(word)
+	}
+
+	iw.writeUvarint(uint64(len(node.terminalNodes)))
+	for _, terminalNode := range node.terminalNodes {
+		iw.writeUvarint(fileIdx[terminalNode.FullPath()])
+		iw.writeVarint(int64(terminalNode.LineNumber))
+		iw.writeUvarint(uint64(len(terminalNode.Occurrences)))
+		for _, occurrence := range terminalNode.Occurrences {
+			iw.writeOccurrence(occurrence, wordIdx)
+		}
+	}
+
+	iw.writeUvarint(uint64(len(node.children)))
+	for idx, child := range node.children {
+		iw.writeVarint(int64(node.childRunes[idx]))
+		iw.writeNode(child, fileIdx)
+	}
+}
+
+func (iw *indexWriter) writeOccurrence(occurrence Occurrence, wordIdx map[string]uint64) {
+	iw.writeUvarint(wordIdx[occurrence.Word])
+	iw.writeVarint(int64(occurrence.Position))
+	iw.writeVarint(int64(occurrence.Column))
+	iw.writeVarint(int64(occurrence.RuneColumn))
+}
+
+type indexReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	err error
+}
+
+func newIndexReader(r *bufio.Reader) *indexReader {
+	return &indexReader{
+		r:   r,
+		crc: crc32.NewIEEE(),
+	}
+}
+
+func (ir *indexReader) ReadByte() (byte, error) {
+	b, err := ir.r.ReadByte()
+	if err == nil {
+		ir.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (ir *indexReader) readUvarint() uint64 {
+	if ir.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(ir)
+	ir.err = err
+	return v
+}
+
+func (ir *indexReader) readVarint() int64 {
+	if ir.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(ir)
+	ir.err = err
+	return v
+}
+
+func (ir *indexReader) readLength() int {
+	v := ir.readUvarint()
+	if v > maxIndexLength {
+		ir.err = ErrIndexCorrupt
+		return 0
+	}
+	return int(v)
+}
+
+func (ir *indexReader) readString() string {
+	length := ir.readLength()
+	if ir.err != nil {
+		return ""
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(ir.r, b); err != nil {
+		ir.err = err
+		return ""
+	}
+	ir.crc.Write(b)
+	return string(b)
+}
+
+func (ir *indexReader) readFile() fullfileinfo.Full {
+	fullPath := ir.readString()
+	name := ir.readString()
+	size := ir.readVarint()
+	mode := fs.FileMode(ir.readUvarint())
+	modTime := time.Unix(0, ir.readVarint())
+
+	return fullfileinfo.NewFull(fullfileinfo.NewFileInfo(name, size, mode, modTime), fullPath)
+}
+
+// read the positions, in the file table, of the files of a set, see writeFileSet, into fileSet
+func (ir *indexReader) readFileSet(files []fullfileinfo.Full, fileSet map[string]struct{}) {
+	count := ir.readLength()
+	for i := 0; i < count && ir.err == nil; i++ {
+		fileIdx := ir.readUvarint()
+		if ir.err == nil && fileIdx >= uint64(len(files)) {
+			ir.err = fmt.Errorf("%w: file index %v out of range", ErrIndexCorrupt, fileIdx)
+		}
+		if ir.err != nil {
+			break
+		}
+		fileSet[files[fileIdx].FullPath()] = struct{}{}
+	}
+}
+
+// read the node at depth, i.e. the number of runes of the words below it, which is at most maxWordLength, so that a
+// corrupt chain of nodes can not recurse without end
+func (ir *indexReader) readNode(files []fullfileinfo.Full, depth int32) *TrieNode {
+	node := newTrieNode()
+	if depth > maxWordLength+1 {
+		ir.err = fmt.Errorf("%w: nodes deeper than the longest word", ErrIndexCorrupt)
+		return node
+	}
+
+	wordCount := ir.readLength()
+	for i := 0; i < wordCount && ir.err == nil; i++ {
+		node.words = append(node.words, ir.readString())
+	}
+
+	terminalCount := ir.readLength()
+	for i := 0; i < terminalCount && ir.err == nil; i++ {
+		fileIdx := ir.readUvarint()
+		lineNumber := int32(ir.readVarint())
+		if ir.err == nil && fileIdx >= uint64(len(files)) {
+			ir.err = fmt.Errorf("%w: file index %v out of range", ErrIndexCorrupt, fileIdx)
+		}
+		occurrenceCount := ir.readLength()
+		if ir.err != nil {
+			break
+		}
+		occurrences := make([]Occurrence, 0, min(occurrenceCount, 64))
+		for k := 0; k < occurrenceCount && ir.err == nil; k++ {
+			occurrences = append(occurrences, ir.readOccurrence(node.words))
+		}
+		node.terminalNodes = append(node.terminalNodes, &TerminalNode{
+			files[fileIdx],
+			lineNumber,
+			occurrences,
+		})
+	}
+
+	childCount := ir.readLength()
+	for i := 0; i < childCount && ir.err == nil; i++ {
+		r := rune(ir.readVarint())
+		// children are stored in order, which keeps childRunes sorted
+		if ir.err == nil && i > 0 && r <= node.childRunes[i-1] {
+			ir.err = fmt.Errorf("%w: child %v out of order", ErrIndexCorrupt, r)
+		}
+		if ir.err != nil {
+			break
+		}
+		node.childRunes = append(node.childRunes, r)
+		node.children = append(node.children, ir.readNode(files, depth+1))
+	}
+
+	return node
+}
+
+func (ir *indexReader) readOccurrence(words []string) Occurrence {
+	wordIdx := ir.readUvarint()
+	position := int32(ir.readVarint())
+	column := int32(ir.readVarint())
+	runeColumn := int32(ir.readVarint())
+	if ir.err == nil && wordIdx >= uint64(len(words)) {
+		ir.err = fmt.Errorf("%w: word index %v out of range", ErrIndexCorrupt, wordIdx)
+	}
+	if ir.err != nil {
+		return Occurrence{}
+	}
+
+	return Occurrence{
+		Word:       words[wordIdx],
+		Position:   position,
+		Column:     column,
+		RuneColumn: runeColumn,
+	}
+}
@@ -0,0 +1,135 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrie_SaveLoadRoundTrip(t *testing.T) {
+	trie := NewTrie(1)
+	fileInfo, _ := os.Stat("./testdata/test_trie_add_1.txt")
+	trie.Add(fullfileinfo.NewFull(fileInfo, "./testdata/test_trie_add_1.txt"))
+
+	tempDir := t.TempDir()
+	indexPath := filepath.Join(tempDir, "index", "test.idx")
+	assert.Nil(t, trie.SaveFile(indexPath, "/root"))
+
+	loaded, err := LoadFile(indexPath, "/root", 1)
+	assert.Nil(t, err)
+
+	for _, term := range []string{"main", "0", "random", "line", "under_scores12", "scores"} {
+		expected, _ := trie.Find(term, MatchInfix, false)
+		actual, _ := loaded.Find(term, MatchInfix, false)
+		assert.Equal(t, len(expected), len(actual), term)
+		for i := range expected {
+			assert.Equal(t, expected[i].FullPath(), actual[i].FullPath())
+			assert.Equal(t, expected[i].LineNumber, actual[i].LineNumber)
+			assert.Equal(t, expected[i].Occurrences, actual[i].Occurrences)
+		}
+	}
+
+	loadedFile := loaded.Files()["./testdata/test_trie_add_1.txt"]
+	assert.Equal(t, fileInfo.Size(), loadedFile.Size())
+	assert.True(t, fileInfo.ModTime().Equal(loadedFile.ModTime()))
+	assert.Equal(t, fileInfo.Name(), loadedFile.Name())
+}
+
+func TestTrie_LoadMismatch(t *testing.T) {
+	trie := NewTrie(5)
+	trie.addLine("hello There", createDummyFileInfo(), 20, false)
+
+	var buf bytes.Buffer
+	assert.Nil(t, trie.save(&buf, "/root"))
+
+	_, err := load(bytes.NewReader(buf.Bytes()), "/other", 5)
+	assert.Equal(t, ErrIndexMismatch, err)
+
+	_, err = load(bytes.NewReader(buf.Bytes()), "/root", 4)
+	assert.Equal(t, ErrIndexMismatch, err)
+
+	loaded, err := load(bytes.NewReader(buf.Bytes()), "/root", 5)
+	assert.Nil(t, err)
+	result, _ := loaded.Search("hello", true)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, "/a/file.out", result[0].FullPath())
+}
+
+func TestTrie_LoadCorrupt(t *testing.T) {
+	trie := NewTrie(5)
+	trie.addLine("hello There", createDummyFileInfo(), 20, false)
+
+	var buf bytes.Buffer
+	assert.Nil(t, trie.save(&buf, "/root"))
+	data := buf.Bytes()
+
+	// flip a byte in the body
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-8] ^= 0xFF
+	_, err := load(bytes.NewReader(corrupted), "/root", 5)
+	assert.NotNil(t, err)
+
+	// truncated
+	_, err = load(bytes.NewReader(data[:len(data)/2]), "/root", 5)
+	assert.ErrorIs(t, err, ErrIndexCorrupt)
+
+	// not an index at all
+	_, err = load(bytes.NewReader([]byte("hello")), "/root", 5)
+	assert.ErrorIs(t, err, ErrIndexCorrupt)
+
+	// a different version
+	versioned := append([]byte{}, data...)
+	binary.LittleEndian.PutUint32(versioned[len(indexMagic):], indexVersion+1)
+	_, err = load(bytes.NewReader(versioned), "/root", 5)
+	assert.Equal(t, ErrIndexVersion, err)
+
+	// a file index, of a file with long lines, that overflows a uvarint
+	var overflowing bytes.Buffer
+	overflowing.WriteString(indexMagic)
+	binary.Write(&overflowing, binary.LittleEndian, indexVersion)
+	iw := newIndexWriter(&overflowing)
+	iw.writeString("/root")
+	iw.writeVarint(5)
+	iw.writeUvarint(0)
+	iw.writeUvarint(1)
+	iw.write(bytes.Repeat([]byte{0xFF}, binary.MaxVarintLen64+1))
+	_, err = load(bytes.NewReader(overflowing.Bytes()), "/root", 5)
+	assert.ErrorIs(t, err, ErrIndexCorrupt)
+}
+
+func TestTrie_LoadTooDeep(t *testing.T) {
+	// an index of no files, with a single chain of nodes of the given depth
+	chain := func(depth int) []byte {
+		var buf bytes.Buffer
+		buf.WriteString(indexMagic)
+		binary.Write(&buf, binary.LittleEndian, indexVersion)
+		iw := newIndexWriter(&buf)
+		iw.writeString("/root")
+		iw.writeVarint(5)
+		// no files, with long lines, or that look binary
+		iw.writeUvarint(0)
+		iw.writeUvarint(0)
+		iw.writeUvarint(0)
+		for d := 0; d <= depth; d++ {
+			iw.writeUvarint(0)
+			iw.writeUvarint(0)
+			if d < depth {
+				iw.writeUvarint(1)
+				iw.writeVarint('a')
+			} else {
+				iw.writeUvarint(0)
+			}
+		}
+		binary.Write(&buf, binary.LittleEndian, iw.crc.Sum32())
+		return buf.Bytes()
+	}
+
+	_, err := load(bytes.NewReader(chain(int(maxWordLength))), "/root", 5)
+	assert.Nil(t, err)
+	_, err = load(bytes.NewReader(chain(int(maxWordLength)+2)), "/root", 5)
+	assert.ErrorIs(t, err, ErrIndexCorrupt)
+}
@@ -0,0 +1,107 @@
+package trie
+
+import (
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// runes that are likely to collide with one another in a naive child layout
+var propertyAlphabet = []rune("az09_AZÄäσΣςЖж東")
+
+func randomWord(random *rand.Rand, maxLength int) string {
+	length := 1 + random.Intn(maxLength)
+	runes := make([]rune, length)
+	for i := range runes {
+		runes[i] = propertyAlphabet[random.Intn(len(propertyAlphabet))]
+	}
+	return string(runes)
+}
+
+func TestTrie_SearchReturnsOnlyExactMatches(t *testing.T) {
+	random := rand.New(rand.NewSource(6))
+
+	for round := 0; round < 20; round++ {
+		trie := NewTrie(1)
+		file := fullfileinfo.NewFull(nil, "/a/file.out")
+
+		// one word per line, so that the line number of a result identifies the word that was matched
+		var words []string
+		for lineNumber := int32(1); lineNumber <= 300; lineNumber++ {
+			word := randomWord(random, 4)
+			words = append(words, word)
+			trie.addLine(word, file, lineNumber, true)
+		}
+		assertValidNode(t, trie.root)
+
+		for i := 0; i < 300; i++ {
+			var term string
+			if i%2 == 0 {
+				term = words[random.Intn(len(words))]
+			} else {
+				term = randomWord(random, 4)
+			}
+			foldedTerm := Fold(term)
+
+			for _, matchWord := range []bool{true, false} {
+				var expectedLines []int32
+				for idx, word := range words {
+					foldedWord := Fold(word)
+					if (matchWord && foldedWord == foldedTerm) || (!matchWord && strings.HasPrefix(foldedWord, foldedTerm)) {
+						expectedLines = append(expectedLines, int32(idx+1))
+					}
+				}
+
+				result, err := trie.Search(term, matchWord)
+				assert.Nil(t, err)
+				for _, terminalNode := range result {
+					word := Fold(words[terminalNode.LineNumber-1])
+					if matchWord {
+						assert.Equal(t, foldedTerm, word)
+					} else {
+						assert.True(t, strings.HasPrefix(word, foldedTerm), "%v does not start with %v", word, foldedTerm)
+					}
+				}
+				assert.Equal(t, len(expectedLines), len(result), "term %v, matchWord %v", term, matchWord)
+			}
+		}
+	}
+}
+
+func TestTrie_DigitsAndLettersDoNotAlias(t *testing.T) {
+	trie := NewTrie(1)
+	trie.addLine("zeta", createDummyFileInfo(), 1, false)
+	trie.addLine("0eta", createDummyFileInfo(), 2, false)
+	trie.addLine("_eta", createDummyFileInfo(), 3, false)
+
+	for lineNumber, term := range map[int32]string{1: "zeta", 2: "0eta", 3: "_eta"} {
+		result, _ := trie.Search(term, true)
+		assert.Equal(t, 1, len(result), term)
+		assert.Equal(t, lineNumber, result[0].LineNumber, term)
+	}
+}
+
+func TestTrie_SearchInvalidCharacter(t *testing.T) {
+	trie := NewTrie(1)
+	trie.addLine("abcd", createDummyFileInfo(), 1, false)
+
+	result, err := trie.Search("ab-cd", true)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(result))
+}
+
+// every child must be reachable by exactly one, distinct, folded rune
+func assertValidNode(t *testing.T, node *TrieNode) {
+	assert.Equal(t, len(node.childRunes), len(node.children))
+	for idx, child := range node.children {
+		r := node.childRunes[idx]
+		assert.Equal(t, FoldRune(r), r)
+		if idx > 0 {
+			assert.Less(t, node.childRunes[idx-1], r)
+		}
+		assert.Same(t, child, node.child(r))
+		assertValidNode(t, child)
+	}
+}
@@ -0,0 +1,178 @@
+package trie
+
+import (
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
+	"path/filepath"
+	"strings"
+)
+
+// Remove drops the given files, and every terminal node that refers to them, from the trie
+func (trie *Trie) Remove(fullPaths map[string]struct{}) {
+	trie.mu.Lock()
+	defer trie.mu.Unlock()
+
+	trie.remove(fullPaths)
+}
+
+// Replace removes the file at fullPath, or every file below it when it is a directory, and then adds the files in
+// toAdd, without searches seeing the trie in between. What is removed is decided while the trie is locked, so that
+// replacing paths that overlap at the same time, e.g. a new directory and a file in it, does not add a file twice.
+func (trie *Trie) Replace(fullPath string, toAdd []fullfileinfo.Full) {
+	indexed := trie.index(toAdd, 1)
+
+	trie.mu.Lock()
+	defer trie.mu.Unlock()
+
+	toRemove := make(map[string]struct{})
+	for indexedPath := range trie.files {
+		if indexedPath == fullPath || strings.HasPrefix(indexedPath, fullPath+string(filepath.Separator)) {
+			toRemove[indexedPath] = struct{}{}
+		}
+	}
+	trie.remove(toRemove)
+	trie.merge(indexed)
+}
+
+func (trie *Trie) remove(fullPaths map[string]struct{}) {
+	if len(fullPaths) == 0 {
+		return
+	}
+
+	for fullPath := range fullPaths {
+		if _, exists := trie.files[fullPath]; exists {
+			delete(trie.files, fullPath)
+			trie.paths.remove(fullPath)
+		}
+		delete(trie.longLines, fullPath)
+		delete(trie.binary, fullPath)
+	}
+
+	trie.removeFromNode(trie.root, fullPaths)
+}
+
+// return whether the node still holds any terminal nodes, itself or below it
+func (trie *Trie) removeFromNode(node *TrieNode, fullPaths map[string]struct{}) bool {
+	removeCount := 0
+	for _, terminalNode := range node.terminalNodes {
+		if _, remove := fullPaths[terminalNode.FullPath()]; remove {
+			removeCount++
+		}
+	}
+
+	if removeCount > 0 {
+		// copy rather than filter in place, a previous search result may still refer to the old slice
+		kept := make([]*TerminalNode, 0, len(node.terminalNodes)-removeCount)
+		for _, terminalNode := range node.terminalNodes {
+			if _, remove := fullPaths[terminalNode.FullPath()]; !remove {
+				kept = append(kept, terminalNode)
+			}
+		}
+		if len(kept) == 0 {
+			trie.words.remove(Fold(node.words[0]))
+		}
+		node.terminalNodes = kept
+		node.words = usedWords(kept)
+	}
+
+	// keep the children that are still in use, in place
+	keptCount := 0
+	for idx, child := range node.children {
+		if trie.removeFromNode(child, fullPaths) {
+			node.childRunes[keptCount] = node.childRunes[idx]
+			node.children[keptCount] = child
+			keptCount++
+		}
+	}
+	for idx := keptCount; idx < len(node.children); idx++ {
+		node.children[idx] = nil
+	}
+	node.childRunes = node.childRunes[:keptCount]
+	node.children = node.children[:keptCount]
+
+	return len(node.terminalNodes) > 0 || keptCount > 0
+}
+
+// return the distinct words of the occurrences, in the order they were first used
+func usedWords(terminalNodes []*TerminalNode) []string {
+	var result []string
+	seen := make(map[string]struct{})
+	for _, terminalNode := range terminalNodes {
+		for _, occurrence := range terminalNode.Occurrences {
+			if _, exists := seen[occurrence.Word]; !exists {
+				seen[occurrence.Word] = struct{}{}
+				result = append(result, occurrence.Word)
+			}
+		}
+	}
+	return result
+}
+
+// Sync brings the trie in line with files: new files are added, files with a different size or modification time are
+// re-added, and files that are no longer present are removed. Files are indexed using the given number of workers.
+// return the number of files added, changed, and removed
+func (trie *Trie) Sync(files []fullfileinfo.Full, workers int) (int, int, int) {
+	return trie.sync(trie.Files(), files, workers)
+}
+
+// Sync, with indexedFiles what the trie held when it was called
+func (trie *Trie) sync(indexedFiles map[string]fullfileinfo.Full, files []fullfileinfo.Full, workers int) (int, int, int) {
+	var toAdd []fullfileinfo.Full
+	toRemove := make(map[string]struct{})
+	added := 0
+	changed := 0
+
+	present := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		present[file.FullPath()] = struct{}{}
+		indexedFile, exists := indexedFiles[file.FullPath()]
+		if !exists {
+			added++
+			toAdd = append(toAdd, file)
+		} else if !sameStat(indexedFile, file) {
+			changed++
+			toRemove[file.FullPath()] = struct{}{}
+			toAdd = append(toAdd, file)
+		}
+	}
+
+	removed := 0
+	for fullPath := range indexedFiles {
+		if _, exists := present[fullPath]; !exists {
+			removed++
+			toRemove[fullPath] = struct{}{}
+		}
+	}
+
+	indexed := trie.index(toAdd, workers)
+
+	trie.mu.Lock()
+	defer trie.mu.Unlock()
+
+	// a file may have been added, e.g. by Replace, while indexing, which is replaced rather than added a second time
+	for fullPath := range indexed.files {
+		toRemove[fullPath] = struct{}{}
+	}
+	trie.remove(toRemove)
+	trie.merge(indexed)
+
+	return added, changed, removed
+}
+
+// Unchanged returns whether file is in the trie, with the same size and modification time, so that Sync leaves it as
+// is, and was indexed as it does not look binary. A file that looks binary was only indexed as it was included
+// regardless, which may no longer be so.
+func (trie *Trie) Unchanged(file fullfileinfo.Full) bool {
+	trie.mu.RLock()
+	defer trie.mu.RUnlock()
+
+	indexedFile, exists := trie.files[file.FullPath()]
+	_, binary := trie.binary[file.FullPath()]
+	return exists && sameStat(indexedFile, file) && !binary
+}
+
+func sameStat(a fullfileinfo.Full, b fullfileinfo.Full) bool {
+	if a.FileInfo == nil || b.FileInfo == nil {
+		return false
+	}
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
@@ -0,0 +1,179 @@
+package trie
+
+import (
+	"bytes"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTrie_Remove(t *testing.T) {
+	trie := NewTrie(5)
+	fileA := fullfileinfo.NewFull(nil, "/a/file.out")
+	fileB := fullfileinfo.NewFull(nil, "/b/file.out")
+	trie.addLine("hello There", fileA, 1, true)
+	trie.addLine("hello apples", fileB, 1, true)
+
+	trie.Remove(map[string]struct{}{"/a/file.out": {}})
+
+	result, _ := trie.Search("hello", true)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, "/b/file.out", result[0].FullPath())
+
+	// the node for "there" is no longer used, so is pruned
+	result, _ = trie.Search("ther", false)
+	assert.Equal(t, 0, len(result))
+	assert.Nil(t, trie.root.child('t'))
+	result, _ = trie.Find("here", MatchInfix, false)
+	assert.Equal(t, 0, len(result))
+	result, _ = trie.Find("ello", MatchSuffix, false)
+	assert.Equal(t, 1, len(result))
+}
+
+func TestTrie_Replace(t *testing.T) {
+	dir := t.TempDir()
+	files := statFiles(t, writeTestFile(t, dir, "sub/a.txt", "hello there"), writeTestFile(t, dir, "subway.txt", "hello again"))
+	file, other := files[0], files[1]
+
+	trie := NewTrie(4)
+	trie.Replace(other.FullPath(), []fullfileinfo.Full{other})
+	// a new directory, and the file in it, both replaced with what they hold
+	trie.Replace(file.FullPath(), []fullfileinfo.Full{file})
+	trie.Replace(filepath.Join(dir, "sub"), []fullfileinfo.Full{file})
+
+	result, _ := trie.Search("there", true)
+	assert.Equal(t, 1, len(result))
+	result, _ = trie.Search("hello", true)
+	assert.Equal(t, 2, len(result))
+
+	// a file in a directory with a name that starts the same is not below it
+	trie.Replace(filepath.Join(dir, "sub"), nil)
+	assert.Equal(t, []string{other.FullPath()}, fullPaths(trie))
+}
+
+func fullPaths(trie *Trie) []string {
+	var result []string
+	for fullPath := range trie.Files() {
+		result = append(result, fullPath)
+	}
+	return result
+}
+
+func TestTrie_ConsolidateOnLineNumberPerFile(t *testing.T) {
+	trie := NewTrie(4)
+	trie.addLine("main main", fullfileinfo.NewFull(nil, "/a/file.out"), 3, true)
+	trie.addLine("main", fullfileinfo.NewFull(nil, "/b/file.out"), 3, true)
+
+	// the same line number in a different file is not consolidated
+	result, _ := trie.Search("main", true)
+	assert.Equal(t, 2, len(result))
+	assert.Equal(t, "/a/file.out", result[0].FullPath())
+	assert.Equal(t, "/b/file.out", result[1].FullPath())
+}
+
+func TestTrie_Sync(t *testing.T) {
+	tempDir := t.TempDir()
+	keepPath := writeTestFile(t, tempDir, "keep.txt", "unchanged content")
+	editPath := writeTestFile(t, tempDir, "edit.txt", "original content")
+	deletePath := writeTestFile(t, tempDir, "delete.txt", "deleted content")
+
+	trie := NewTrie(4)
+	added, changed, removed := trie.Sync(statFiles(t, keepPath, editPath, deletePath), 1)
+	assert.Equal(t, []int{3, 0, 0}, []int{added, changed, removed})
+
+	writeTestFile(t, tempDir, "edit.txt", "edited content")
+	// make sure the modification time differs, even on file systems with a coarse resolution
+	later := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(editPath, later, later))
+	newPath := writeTestFile(t, tempDir, "new.txt", "fresh content")
+
+	added, changed, removed = trie.Sync(statFiles(t, keepPath, editPath, newPath), 2)
+	assert.Equal(t, []int{1, 1, 1}, []int{added, changed, removed})
+
+	result, _ := trie.Search("original", true)
+	assert.Equal(t, 0, len(result))
+	result, _ = trie.Search("deleted", true)
+	assert.Equal(t, 0, len(result))
+	result, _ = trie.Search("edited", true)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, editPath, result[0].FullPath())
+	result, _ = trie.Search("content", true)
+	assert.Equal(t, 3, len(result))
+	assert.Equal(t, 3, len(trie.Files()))
+
+	added, changed, removed = trie.Sync(statFiles(t, keepPath, editPath, newPath), 2)
+	assert.Equal(t, []int{0, 0, 0}, []int{added, changed, removed})
+
+	assert.True(t, trie.Unchanged(statFiles(t, keepPath)[0]))
+	assert.Nil(t, os.Chtimes(keepPath, later.Add(time.Minute), later.Add(time.Minute)))
+	assert.False(t, trie.Unchanged(statFiles(t, keepPath)[0]))
+	assert.False(t, trie.Unchanged(fullfileinfo.NewFull(nil, deletePath)))
+}
+
+func TestTrie_SyncWhileReplaced(t *testing.T) {
+	newPath := writeTestFile(t, t.TempDir(), "new.txt", "fresh content")
+	files := statFiles(t, newPath)
+
+	trie := NewTrie(4)
+	indexedFiles := trie.Files()
+	// the watcher adds the file after Sync looked at what the trie holds
+	trie.Replace(newPath, files)
+	added, changed, removed := trie.sync(indexedFiles, files, 1)
+	assert.Equal(t, []int{1, 0, 0}, []int{added, changed, removed})
+
+	result, _ := trie.Search("fresh", true)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, 1, len(result[0].Occurrences))
+}
+
+func TestTrie_UnchangedBinary(t *testing.T) {
+	tempDir := t.TempDir()
+	textPath := writeTestFile(t, tempDir, "text.txt", "plain content")
+	// indexed as it was included regardless of looking binary
+	binaryPath := writeTestFile(t, tempDir, "data.dat", "binary\x00content")
+
+	trie := NewTrie(4)
+	trie.Sync(statFiles(t, textPath, binaryPath), 1)
+	assert.True(t, trie.Unchanged(statFiles(t, textPath)[0]))
+	assert.False(t, trie.Unchanged(statFiles(t, binaryPath)[0]))
+
+	var buf bytes.Buffer
+	assert.Nil(t, trie.save(&buf, "/root"))
+	loaded, err := load(bytes.NewReader(buf.Bytes()), "/root", 4)
+	assert.Nil(t, err)
+	assert.True(t, loaded.Unchanged(statFiles(t, textPath)[0]))
+	assert.False(t, loaded.Unchanged(statFiles(t, binaryPath)[0]))
+
+	// still indexed as before by Sync, while it is included
+	added, changed, removed := loaded.Sync(statFiles(t, textPath, binaryPath), 1)
+	assert.Equal(t, []int{0, 0, 0}, []int{added, changed, removed})
+
+	loaded.Remove(map[string]struct{}{binaryPath: {}})
+	assert.Equal(t, 0, len(loaded.binary))
+}
+
+func writeTestFile(t *testing.T, dir string, name string, content string) string {
+	fullPath := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fullPath
+}
+
+func statFiles(t *testing.T, fullPaths ...string) []fullfileinfo.Full {
+	var result []fullfileinfo.Full
+	for _, fullPath := range fullPaths {
+		fileInfo, err := os.Stat(fullPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, fullfileinfo.NewFull(fileInfo, fullPath))
+	}
+	return result
+}
@@ -0,0 +1,39 @@
+package trie
+
+import (
+	"strings"
+	"unicode"
+)
+
+// IsWordRune returns whether r is part of a word: any unicode letter, digit, or combining mark, or an underscore
+func IsWordRune(r rune) bool {
+	if r < 0x80 {
+		return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_'
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// FoldRune returns the rune that all case variants of r are indexed under.
+// Unlike unicode.ToLower, this maps every rune of a case folding orbit to the same rune, e.g. 'Σ', 'σ' and 'ς' all map
+// to 'σ', and the Kelvin sign maps to 'k'.
+func FoldRune(r rune) rune {
+	if r < 0x80 {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}
+
+	smallest := r
+	for folded := unicode.SimpleFold(r); folded != r; folded = unicode.SimpleFold(folded) {
+		if folded < smallest {
+			smallest = folded
+		}
+	}
+	return unicode.ToLower(smallest)
+}
+
+// Fold applies FoldRune to every rune of s; the result has the same number of runes as s
+func Fold(s string) string {
+	return strings.Map(FoldRune, s)
+}
@@ -1,76 +1,202 @@
 package trie
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fileutil"
 	"github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
-	"log"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 )
 
 type Trie struct {
+	// guards everything below, searches may run while files are being (re-)indexed
+	mu            sync.RWMutex
 	root          *TrieNode
 	minWordLength int32
+	files         map[string]fullfileinfo.Full
+	words         *wordIndex
+	paths         *pathIndex
+	// the files with a line longer than fileutil.MaxLineLength, which is indexed in full, but only shown in part
+	longLines map[string]struct{}
+	// the files that look binary, see fullfileinfo.IsBinary, which were indexed as they were included regardless
+	binary map[string]struct{}
 }
 
 type TrieNode struct {
+	// childRunes is sorted, children[i] is the child for childRunes[i]; far smaller than a slot for every possible rune
+	childRunes    []rune
 	children      []*TrieNode
 	terminalNodes []*TerminalNode
-	lineNumbers   map[int32]struct{}
+	// the distinct spellings, as they appear in files, of the word ending at this node; shared by the occurrences
+	words []string
 }
 
 type TerminalNode struct {
 	fullfileinfo.Full
 	LineNumber int32
+	// every occurrence of the word on the line, when consolidating on line number, otherwise just one
+	Occurrences []Occurrence
+}
+
+type Occurrence struct {
+	// the word as it appears in the file, i.e. with its original case
+	Word string
+	// the number of words before this one on the line, including words too short to be indexed
+	Position int32
+	// the byte offset of the word in the line, from 0
+	Column int32
+	// the rune offset of the word in the line, from 0
+	RuneColumn int32
 }
 
 func NewTrie(minWordLength int32) *Trie {
 	return &Trie{
-		// this first, simple version, will just work with the 26 letters of the alphabet + 10 numbers
 		root:          newTrieNode(),
 		minWordLength: minWordLength,
+		files:         make(map[string]fullfileinfo.Full),
+		longLines:     make(map[string]struct{}),
+		binary:        make(map[string]struct{}),
+		words:         newWordIndex(),
+		paths:         newPathIndex(),
 	}
 }
 
 func newTrieNode() *TrieNode {
-	return &TrieNode{
-		// this first, simple version, will just work with the 26 letters of the alphabet + 10 numbers
-		children:    make([]*TrieNode, 37),
-		lineNumbers: make(map[int32]struct{}),
+	return &TrieNode{}
+}
+
+// return the child for r, or nil if there is none
+func (node *TrieNode) child(r rune) *TrieNode {
+	idx, found := node.childIdx(r)
+	if !found {
+		return nil
 	}
+	return node.children[idx]
 }
 
-func (trie Trie) Search(searchTerm string, matchWord bool) ([]*TerminalNode, error) {
-	var result []*TerminalNode
-	var err error
-	var atNode = trie.root
-	didComplete := true
-	for i := 0; i < len(searchTerm); i++ {
-		c := searchTerm[i]
-		idx := determineIdx(c)
-
-		if idx == nil {
-			err = errors.New(fmt.Sprintf("Invalid character in search query %s", string(c)))
-		} else {
-			targetChild := atNode.children[*idx]
-			if targetChild != nil {
-				atNode = targetChild
+// return the child for r, creating it if there is none
+func (node *TrieNode) addChild(r rune) *TrieNode {
+	idx, found := node.childIdx(r)
+	if found {
+		return node.children[idx]
+	}
+
+	child := newTrieNode()
+	node.insertChildAt(idx, r, child)
+
+	return child
+}
+
+// add child for r, which must not have a child yet
+func (node *TrieNode) insertChild(r rune, child *TrieNode) {
+	idx, _ := node.childIdx(r)
+	node.insertChildAt(idx, r, child)
+}
+
+func (node *TrieNode) insertChildAt(idx int, r rune, child *TrieNode) {
+	node.childRunes = append(node.childRunes, 0)
+	copy(node.childRunes[idx+1:], node.childRunes[idx:])
+	node.childRunes[idx] = r
+	node.children = append(node.children, nil)
+	copy(node.children[idx+1:], node.children[idx:])
+	node.children[idx] = child
+}
+
+// return where r is, or should be inserted, in childRunes, and whether it is there
+func (node *TrieNode) childIdx(r rune) (int, bool) {
+	idx := sort.Search(len(node.childRunes), func(i int) bool {
+		return node.childRunes[i] >= r
+	})
+	return idx, idx < len(node.childRunes) && node.childRunes[idx] == r
+}
+
+// Match is how a search term is compared to the indexed words
+type Match int
+
+const (
+	// MatchWord matches the whole word
+	MatchWord Match = iota
+	// MatchPrefix matches the start of a word
+	MatchPrefix
+	// MatchSuffix matches the end of a word
+	MatchSuffix
+	// MatchInfix matches any part of a word
+	MatchInfix
+)
+
+// MinWordLength returns the number of runes a word needs to have to be indexed
+func (trie *Trie) MinWordLength() int32 {
+	return trie.minWordLength
+}
+
+func (trie *Trie) Search(searchTerm string, matchWord bool) ([]*TerminalNode, error) {
+	match := MatchPrefix
+	if matchWord {
+		match = MatchWord
+	}
+	return trie.Find(searchTerm, match, false)
+}
+
+// Find returns the lines with a word that matches searchTerm, compared as per match.
+// With caseSensitive, the word must also have the same case as searchTerm.
+func (trie *Trie) Find(searchTerm string, match Match, caseSensitive bool) ([]*TerminalNode, error) {
+	if err := validateTerm(searchTerm); err != nil {
+		return nil, err
+	}
+	foldedTerm := Fold(searchTerm)
+
+	trie.mu.RLock()
+	var candidates []*TerminalNode
+	if match == MatchWord || match == MatchPrefix {
+		atNode := trie.root.find(foldedTerm)
+		if atNode != nil {
+			if match == MatchWord {
+				candidates = atNode.terminalNodes
 			} else {
-				didComplete = false
+				candidates = findAllChildNodeChildren(*atNode)
 			}
 		}
+	} else {
+		candidates = trie.words.find(foldedTerm, match)
 	}
-	if didComplete {
-		if matchWord {
-			result = atNode.terminalNodes
-		} else {
-			result = findAllChildNodeChildren(*atNode)
+	trie.mu.RUnlock()
+
+	if !caseSensitive {
+		return candidates, nil
+	}
+
+	var result []*TerminalNode
+	for _, terminalNode := range candidates {
+		if terminalNode.HasWord(searchTerm, match) {
+			result = append(result, terminalNode)
 		}
 	}
+	return result, nil
+}
 
-	return result, err
+func validateTerm(searchTerm string) error {
+	for _, c := range searchTerm {
+		if !IsWordRune(c) {
+			// skipping the character would match words without it, so nothing matches
+			return errors.New(fmt.Sprintf("Invalid character in search query %s", string(c)))
+		}
+	}
+	return nil
+}
+
+// return the node for foldedWord, or nil if there is none
+func (node *TrieNode) find(foldedWord string) *TrieNode {
+	atNode := node
+	for _, c := range foldedWord {
+		atNode = atNode.child(c)
+		if atNode == nil {
+			return nil
+		}
+	}
+	return atNode
 }
 
 func findAllChildNodeChildren(node TrieNode) []*TerminalNode {
@@ -88,94 +214,254 @@ func findAllChildNodeChildren(node TrieNode) []*TerminalNode {
 	return result
 }
 
-func determineIdx(c byte) *uint8 {
-	var idx *uint8
-	if c >= 'a' && c <= 'z' {
-		tmp := c - 'a'
-		idx = &tmp
-	} else if c >= '0' && c <= '9' {
-		tmp := c - '0' + 25
-		idx = &tmp
-	} else if c == '_' {
-		tmp := uint8(35 + 1)
-		idx = &tmp
-	}
-	return idx
-}
-
-func (trie Trie) addLine(line string, file fullfileinfo.Full, lineNumber int32, consolidateOnLineNumber bool) {
-	line = strings.ToLower(line)
-	atNode := trie.root
-	wordLength := int32(0)
-	for i := 0; i < len(line); i++ {
-		c := line[i]
-		idx := determineIdx(c)
-		if idx != nil {
-			wordLength++
-			targetChild := atNode.children[*idx]
-			if targetChild == nil {
-				targetChild = newTrieNode()
-				atNode.children[*idx] = targetChild
+// HasWord returns whether one of the occurrences on the line matches term as per match, with the same case
+func (terminalNode *TerminalNode) HasWord(term string, match Match) bool {
+	for _, occurrence := range terminalNode.Occurrences {
+		if matches(occurrence.Word, term, match) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns whether the word of the occurrence matches term as per match.
+// Without caseSensitive, case is ignored.
+func (occurrence Occurrence) Matches(term string, match Match, caseSensitive bool) bool {
+	if caseSensitive {
+		return matches(occurrence.Word, term, match)
+	}
+	return matches(Fold(occurrence.Word), Fold(term), match)
+}
+
+func matches(word string, term string, match Match) bool {
+	switch match {
+	case MatchPrefix:
+		return strings.HasPrefix(word, term)
+	case MatchSuffix:
+		return strings.HasSuffix(word, term)
+	case MatchInfix:
+		return strings.Contains(word, term)
+	default:
+		return word == term
+	}
+}
+
+func (trie *Trie) addLine(line string, file fullfileinfo.Full, lineNumber int32, consolidateOnLineNumber bool) {
+	indexer := trie.newLineIndexer(file, lineNumber, consolidateOnLineNumber)
+	indexer.add(line)
+	indexer.end()
+}
+
+// words longer than this many runes, e.g. base64 data, are not indexed; nobody searches for them, and each rune would
+// be a level of the trie
+const maxWordLength = int32(256)
+
+// lineIndexer adds the words of a line that is read in chunks, a word may continue from one chunk into the next
+type lineIndexer struct {
+	trie                    *Trie
+	file                    fullfileinfo.Full
+	lineNumber              int32
+	consolidateOnLineNumber bool
+	atNode                  *TrieNode
+	// the part of the current word that is in the chunks before the current one
+	wordHead   []byte
+	wordLength int32
+	wordStart  int
+	position   int32
+	// the byte offset, and rune offset, of the current chunk in the line
+	column  int
+	runeIdx int32
+}
+
+func (trie *Trie) newLineIndexer(file fullfileinfo.Full, lineNumber int32, consolidateOnLineNumber bool) *lineIndexer {
+	return &lineIndexer{
+		trie:                    trie,
+		file:                    file,
+		lineNumber:              lineNumber,
+		consolidateOnLineNumber: consolidateOnLineNumber,
+		atNode:                  trie.root,
+	}
+}
+
+// add the words of chunk, the part of the line that follows what was added before
+func (indexer *lineIndexer) add(chunk string) {
+	chunkWordStart := 0
+	for idx, c := range chunk {
+		if IsWordRune(c) {
+			if indexer.wordLength == 0 {
+				indexer.wordStart = indexer.column + idx
+				chunkWordStart = idx
+			}
+			indexer.wordLength++
+			if indexer.wordLength <= maxWordLength {
+				indexer.atNode = indexer.atNode.addChild(FoldRune(c))
 			}
-			atNode = targetChild
 		} else {
-			// create a terminal node
-			if mayUseWord(trie, *atNode, wordLength, lineNumber, consolidateOnLineNumber) {
-				atNode.lineNumbers[lineNumber] = struct{}{}
-				atNode.terminalNodes = append(atNode.terminalNodes, &TerminalNode{
-					file,
-					lineNumber,
-				})
+			if indexer.wordLength > 0 {
+				indexer.endWord(chunk[chunkWordStart:idx])
 			}
-			atNode = trie.root
-			wordLength = 0
+			indexer.atNode = indexer.trie.root
+			indexer.wordLength = 0
 		}
+		indexer.runeIdx++
 	}
 
-	if mayUseWord(trie, *atNode, wordLength, lineNumber, consolidateOnLineNumber) {
-		atNode.terminalNodes = append(atNode.terminalNodes, &TerminalNode{
-			file,
-			lineNumber,
-		})
+	if indexer.wordLength > 0 && indexer.wordLength <= maxWordLength {
+		indexer.wordHead = append(indexer.wordHead, chunk[chunkWordStart:]...)
 	}
+	indexer.column += len(chunk)
 }
 
-func mayUseWord(trie Trie, node TrieNode, wordLength int32, lineNumber int32, consolidateOnLineNumber bool) bool {
-	if wordLength >= trie.minWordLength {
-		if _, exists := node.lineNumbers[lineNumber]; !(consolidateOnLineNumber && exists) {
-			return true
+// add the word the line ends with, if any
+func (indexer *lineIndexer) end() {
+	if indexer.wordLength > 0 {
+		indexer.endWord("")
+	}
+}
+
+// add the current word, with tail the part of it in the current chunk, unless it is too long
+func (indexer *lineIndexer) endWord(tail string) {
+	if indexer.wordLength <= maxWordLength {
+		word := tail
+		if len(indexer.wordHead) > 0 {
+			word = string(indexer.wordHead) + tail
+		}
+		occurrence := Occurrence{
+			Position:   indexer.position,
+			Column:     int32(indexer.wordStart),
+			RuneColumn: indexer.runeIdx - indexer.wordLength,
 		}
+		indexer.trie.addWord(indexer.atNode, word, occurrence, indexer.wordLength, indexer.file, indexer.lineNumber,
+			indexer.consolidateOnLineNumber)
 	}
-	return false
+	indexer.wordHead = indexer.wordHead[:0]
+	indexer.position++
+}
+
+// create a terminal node at node for word, or when consolidating on line number, add word to the line's terminal node.
+// occurrence describes where word is on the line.
+func (trie *Trie) addWord(node *TrieNode, word string, occurrence Occurrence, wordLength int32, file fullfileinfo.Full, lineNumber int32, consolidateOnLineNumber bool) {
+	if wordLength < trie.minWordLength {
+		return
+	}
+
+	occurrence.Word = node.internWord(word)
+
+	if consolidateOnLineNumber && node.endsWithLine(file, lineNumber) {
+		last := node.terminalNodes[len(node.terminalNodes)-1]
+		last.Occurrences = append(last.Occurrences, occurrence)
+		return
+	}
+
+	if len(node.terminalNodes) == 0 {
+		trie.words.add(Fold(word), node)
+	}
+	node.terminalNodes = append(node.terminalNodes, &TerminalNode{
+		file,
+		lineNumber,
+		[]Occurrence{occurrence},
+	})
+}
+
+// return the spelling of word already held by the node, so that each spelling is only held once, rather than per
+// occurrence, and so that the line word was taken from is not kept in memory
+func (node *TrieNode) internWord(word string) string {
+	if known, exists := node.findWord(word); exists {
+		return known
+	}
+	word = string([]byte(word))
+	node.words = append(node.words, word)
+	return word
 }
 
-func (trie Trie) Add(fileInput fullfileinfo.Full) {
+func (node *TrieNode) findWord(word string) (string, bool) {
+	for _, known := range node.words {
+		if known == word {
+			return known, true
+		}
+	}
+	return "", false
+}
+
+// lines of a file are added in order, so a line that already has a terminal node at this node, will have the last one
+func (node TrieNode) endsWithLine(file fullfileinfo.Full, lineNumber int32) bool {
+	if len(node.terminalNodes) == 0 {
+		return false
+	}
+	last := node.terminalNodes[len(node.terminalNodes)-1]
+	return last.LineNumber == lineNumber && last.FullPath() == file.FullPath()
+}
+
+// Files returns the files that have been added to the trie, keyed by their full path
+func (trie *Trie) Files() map[string]fullfileinfo.Full {
+	trie.mu.RLock()
+	defer trie.mu.RUnlock()
+
+	result := make(map[string]fullfileinfo.Full, len(trie.files))
+	for fullPath, file := range trie.files {
+		result[fullPath] = file
+	}
+	return result
+}
+
+// File returns the file with the given full path, if it has been added to the trie
+func (trie *Trie) File(fullPath string) (fullfileinfo.Full, bool) {
+	trie.mu.RLock()
+	defer trie.mu.RUnlock()
+
+	file, exists := trie.files[fullPath]
+	return file, exists
+}
+
+func (trie *Trie) Add(fileInput fullfileinfo.Full) {
+	trie.mu.Lock()
+	defer trie.mu.Unlock()
+
+	trie.add(fileInput)
+}
+
+func (trie *Trie) add(fileInput fullfileinfo.Full) {
 	file, err := os.Open(fileInput.FullPath())
 	if err != nil {
-		log.Fatal(err.Error())
+		// the file may have been removed since it was found, which is not worth stopping for
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("Error opening fullfileinfo %v, error: %v", fileInput.FullPath(), err.Error()))
+		return
 	}
 	defer file.Close()
 
-	scanner := createScanner(file)
+	trie.files[fileInput.FullPath()] = fileInput
+	trie.paths.add(fileInput.FullPath())
+
+	reader := fileutil.NewLineReader(file)
+	start := reader.Peek(fullfileinfo.SniffLength)
+	if fullfileinfo.LooksBinary(start, len(start) == fullfileinfo.SniffLength) {
+		trie.binary[fileInput.FullPath()] = struct{}{}
+	}
 
-	lineNumber := int32(0)
-	for scanner.Scan() {
-		lineNumber += 1
-		line := scanner.Text()
-		trie.addLine(line, fileInput, lineNumber, true)
+	var indexer *lineIndexer
+	for reader.Next() {
+		if reader.Column() == 0 {
+			indexer = trie.newLineIndexer(fileInput, reader.LineNumber(), true)
+		}
+		indexer.add(reader.Chunk())
+		if reader.LineEnded() {
+			indexer.end()
+			if indexer.column > fileutil.MaxLineLength {
+				trie.longLines[fileInput.FullPath()] = struct{}{}
+			}
+		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Println(fmt.Sprintf("Error scanning fullfileinfo %v, error: %v", fileInput.FullPath(), err.Error()))
+	if err := reader.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("Error scanning fullfileinfo %v, error: %v", fileInput.FullPath(), err.Error()))
 	}
 }
 
-func createScanner(file *os.File) *bufio.Scanner {
-	scanner := bufio.NewScanner(file)
+// LongLineFiles returns the number of files with a line longer than fileutil.MaxLineLength. Such a line is indexed in
+// full, but only its start is shown, and matched against regular expressions.
+func (trie *Trie) LongLineFiles() int {
+	trie.mu.RLock()
+	defer trie.mu.RUnlock()
 
-	// Double the default buffer size
-	const maxCapacity = 2048 * 1024 // 2048KB
-	buf := make([]byte, maxCapacity)
-	scanner.Buffer(buf, maxCapacity)
-	return scanner
+	return len(trie.longLines)
 }
@@ -1,9 +1,13 @@
 package trie
 
 import (
+	"bytes"
+	"github.com/sk-manyways/SearchOutlineLabel/internal/fileutil"
 	"github.com/sk-manyways/SearchOutlineLabel/internal/fullfileinfo"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -117,3 +121,204 @@ func TestTrie_Add(t *testing.T) {
 func createDummyFileInfo() fullfileinfo.Full {
 	return fullfileinfo.NewFull(nil, "/a/file.out")
 }
+
+func TestTrie_addLineUnicode(t *testing.T) {
+	trie := NewTrie(4)
+	trie.addLine("Поне една от пробите за сливане", createDummyFileInfo(), 1, false)
+	trie.addLine("ΣΟΦΙΑ σοφία, café naïve 東京都庁舎", createDummyFileInfo(), 2, false)
+
+	// Cyrillic, matched regardless of case
+	result, _ := trie.Search("ПРОБИТЕ", true)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, int32(1), result[0].LineNumber)
+
+	result, _ = trie.Search("слив", false)
+	assert.Equal(t, 1, len(result))
+
+	// Greek, with accents kept as part of the word
+	result, _ = trie.Search("σοφια", true)
+	assert.Equal(t, 1, len(result))
+	result, _ = trie.Search("σοφία", true)
+	assert.Equal(t, 1, len(result))
+
+	// accented Latin is not split
+	result, _ = trie.Search("café", true)
+	assert.Equal(t, 1, len(result))
+	result, _ = trie.Search("naïve", true)
+	assert.Equal(t, 1, len(result))
+	result, _ = trie.Search("naive", true)
+	assert.Equal(t, 0, len(result))
+
+	// CJK
+	result, _ = trie.Search("東京", false)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, int32(2), result[0].LineNumber)
+}
+
+func TestFoldRune(t *testing.T) {
+	assert.Equal(t, 'a', FoldRune('A'))
+	assert.Equal(t, 'σ', FoldRune('Σ'))
+	assert.Equal(t, 'σ', FoldRune('ς'))
+	assert.Equal(t, 'k', FoldRune('K')) // Kelvin sign
+	assert.Equal(t, 'п', FoldRune('П'))
+	assert.Equal(t, '東', FoldRune('東'))
+}
+
+func TestTrie_SearchCaseSensitive(t *testing.T) {
+	trie := NewTrie(4)
+	trie.addLine("type Config struct", createDummyFileInfo(), 1, true)
+	trie.addLine("config := Config{}", createDummyFileInfo(), 2, true)
+	trie.addLine("return config", createDummyFileInfo(), 3, true)
+
+	// the default remains case insensitive
+	result, _ := trie.Search("config", true)
+	assert.Equal(t, 3, len(result))
+
+	result, _ = trie.Find("Config", MatchWord, true)
+	assert.Equal(t, 2, len(result))
+	assert.Equal(t, int32(1), result[0].LineNumber)
+	assert.Equal(t, int32(2), result[1].LineNumber)
+
+	result, _ = trie.Find("conf", MatchPrefix, true)
+	assert.Equal(t, 2, len(result))
+	assert.Equal(t, int32(2), result[0].LineNumber)
+	assert.Equal(t, int32(3), result[1].LineNumber)
+
+	// both spellings on line 2 are kept on the one, consolidated, terminal node
+	result, _ = trie.Search("config", true)
+	assert.Equal(t, []Occurrence{{Word: "config", Position: 0}, {Word: "Config", Position: 1, Column: 10, RuneColumn: 10}}, result[1].Occurrences)
+}
+
+func TestTrie_FindSuffixAndInfix(t *testing.T) {
+	trie := NewTrie(4)
+	trie.addLine("requestHandler errorHandler handle", createDummyFileInfo(), 1, true)
+	trie.addLine("lruCache cachedValue uncached", createDummyFileInfo(), 2, true)
+	trie.addLine("handlers", createDummyFileInfo(), 3, true)
+
+	result, _ := trie.Find("handler", MatchSuffix, false)
+	assert.Equal(t, 2, len(result))
+	assert.Equal(t, "errorHandler", result[0].Occurrences[0].Word)
+	assert.Equal(t, "requestHandler", result[1].Occurrences[0].Word)
+
+	result, _ = trie.Find("cache", MatchInfix, false)
+	assert.Equal(t, 3, len(result))
+	for _, terminalNode := range result {
+		assert.Equal(t, int32(2), terminalNode.LineNumber)
+	}
+
+	// shorter than a gram
+	result, _ = trie.Find("ac", MatchInfix, false)
+	assert.Equal(t, 3, len(result))
+	result, _ = trie.Find("rs", MatchSuffix, false)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, int32(3), result[0].LineNumber)
+
+	result, _ = trie.Find("Handler", MatchSuffix, true)
+	assert.Equal(t, 2, len(result))
+	result, _ = trie.Find("handler", MatchSuffix, true)
+	assert.Equal(t, 0, len(result))
+	result, _ = trie.Find("Cache", MatchInfix, true)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, "lruCache", result[0].Occurrences[0].Word)
+}
+
+func TestTrie_AddLinePositions(t *testing.T) {
+	trie := NewTrie(4)
+	trie.addLine("dial: tcp connection refused, connection", createDummyFileInfo(), 1, true)
+	trie.addLine("über connection", createDummyFileInfo(), 2, true)
+
+	// short words are not indexed, but do count towards the position
+	result, _ := trie.Search("connection", true)
+	assert.Equal(t, []Occurrence{{Word: "connection", Position: 2, Column: 10, RuneColumn: 10}, {Word: "connection", Position: 4, Column: 30, RuneColumn: 30}}, result[0].Occurrences)
+
+	result, _ = trie.Search("refused", true)
+	assert.Equal(t, []Occurrence{{Word: "refused", Position: 3, Column: 21, RuneColumn: 21}}, result[0].Occurrences)
+
+	// ü takes two bytes, but is one rune
+	result, _ = trie.Search("connection", true)
+	assert.Equal(t, []Occurrence{{Word: "connection", Position: 1, Column: 6, RuneColumn: 5}}, result[1].Occurrences)
+}
+
+func TestTrie_AddLongLine(t *testing.T) {
+	// a line longer than fileutil.MaxLineLength, with a word across the first chunk boundary, like minified javascript
+	head := strings.Repeat("x; ", (fileutil.ChunkSize-4)/3)
+	line := head + "boundary; " + strings.Repeat("ab; ", fileutil.MaxLineLength/4) + "needle"
+	fullPath := filepath.Join(t.TempDir(), "app.min.js")
+	if err := os.WriteFile(fullPath, []byte("first line\n"+line+"\nlast needle\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileInfo, _ := os.Stat(fullPath)
+	trie := NewTrie(4)
+	trie.Add(fullfileinfo.NewFull(fileInfo, fullPath))
+
+	result, _ := trie.Search("boundary", true)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, int32(2), result[0].LineNumber)
+	assert.Equal(t, "boundary", result[0].Occurrences[0].Word)
+	assert.Equal(t, int32(len(head)), result[0].Occurrences[0].Column)
+
+	// the whole line is indexed, and the lines after it too
+	result, _ = trie.Search("needle", true)
+	assert.Equal(t, 2, len(result))
+	assert.Equal(t, int32(len(line)-len("needle")), result[0].Occurrences[0].Column)
+	assert.Equal(t, int32(3), result[1].LineNumber)
+	assert.Equal(t, 1, trie.LongLineFiles())
+
+	var buf bytes.Buffer
+	assert.Nil(t, trie.save(&buf, "/root"))
+	loaded, err := load(bytes.NewReader(buf.Bytes()), "/root", 4)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, loaded.LongLineFiles())
+
+	trie.Remove(map[string]struct{}{fullPath: {}})
+	assert.Equal(t, 0, trie.LongLineFiles())
+}
+
+func TestTrie_AddLastLineOfOneChunk(t *testing.T) {
+	// the last word of a file without a trailing newline, which ends exactly at the chunk boundary, is indexed
+	fullPath := filepath.Join(t.TempDir(), "boundary.txt")
+	content := strings.Repeat("a", fileutil.ChunkSize-len(" zebra")) + " zebra"
+	if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileInfo, _ := os.Stat(fullPath)
+	trie := NewTrie(4)
+	trie.Add(fullfileinfo.NewFull(fileInfo, fullPath))
+
+	result, _ := trie.Search("zebra", true)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, int32(fileutil.ChunkSize-len("zebra")), result[0].Occurrences[0].Column)
+}
+
+func TestTrie_addLineLongWord(t *testing.T) {
+	trie := NewTrie(4)
+	long := strings.Repeat("x", int(maxWordLength)+1)
+	trie.addLine(long+" after "+strings.Repeat("y", int(maxWordLength)), createDummyFileInfo(), 1, true)
+
+	result, _ := trie.Search("x", false)
+	assert.Equal(t, 0, len(result))
+	result, _ = trie.Search("after", true)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, int32(1), result[0].Occurrences[0].Position)
+	result, _ = trie.Search("y", false)
+	assert.Equal(t, 1, len(result))
+}
+
+func TestTrie_AddMissingFile(t *testing.T) {
+	// errors go to stderr, stdout is only for what is searched for
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	trie := NewTrie(4)
+	trie.Add(fullfileinfo.NewFull(nil, filepath.Join(t.TempDir(), "missing.txt")))
+	os.Stdout = stdout
+	w.Close()
+
+	var written bytes.Buffer
+	written.ReadFrom(r)
+	assert.Equal(t, "", written.String())
+	assert.Equal(t, 0, len(trie.Files()))
+}
@@ -0,0 +1,112 @@
+package trie
+
+import "sort"
+
+// number of runes in a gram
+const gramLength = 3
+
+// wordIndex holds every (folded) word that has terminal nodes, with the grams of each word, so that words ending with,
+// or containing, a fragment are found without walking the whole trie
+type wordIndex struct {
+	nodes map[string]*TrieNode
+	grams map[string]map[string]struct{}
+}
+
+func newWordIndex() *wordIndex {
+	return &wordIndex{
+		nodes: make(map[string]*TrieNode),
+		grams: make(map[string]map[string]struct{}),
+	}
+}
+
+func (wi *wordIndex) add(word string, node *TrieNode) {
+	wi.nodes[word] = node
+	for _, gram := range grams(word) {
+		words, exists := wi.grams[gram]
+		if !exists {
+			words = make(map[string]struct{})
+			wi.grams[gram] = words
+		}
+		words[word] = struct{}{}
+	}
+}
+
+func (wi *wordIndex) remove(word string) {
+	delete(wi.nodes, word)
+	for _, gram := range grams(word) {
+		words := wi.grams[gram]
+		delete(words, word)
+		if len(words) == 0 {
+			delete(wi.grams, gram)
+		}
+	}
+}
+
+// return the terminal nodes of the words that end with (MatchSuffix), or contain (MatchInfix), fragment
+func (wi *wordIndex) find(fragment string, match Match) []*TerminalNode {
+	var candidates []string
+	fragmentGrams := grams(fragment)
+	if len(fragmentGrams) == 0 {
+		// too short to have a gram, only the words themselves can be checked
+		for word := range wi.nodes {
+			candidates = append(candidates, word)
+		}
+	} else {
+		candidates = wi.wordsWithGrams(fragmentGrams)
+	}
+
+	var words []string
+	for _, word := range candidates {
+		if matches(word, fragment, match) {
+			words = append(words, word)
+		}
+	}
+	sort.Strings(words)
+
+	var result []*TerminalNode
+	for _, word := range words {
+		result = append(result, wi.nodes[word].terminalNodes...)
+	}
+	return result
+}
+
+// return the words that have every one of the grams
+func (wi *wordIndex) wordsWithGrams(grams []string) []string {
+	// start from the gram with the fewest words
+	smallest := wi.grams[grams[0]]
+	for _, gram := range grams[1:] {
+		if len(wi.grams[gram]) < len(smallest) {
+			smallest = wi.grams[gram]
+		}
+	}
+
+	var result []string
+	for word := range smallest {
+		hasAll := true
+		for _, gram := range grams {
+			if _, exists := wi.grams[gram][word]; !exists {
+				hasAll = false
+				break
+			}
+		}
+		if hasAll {
+			result = append(result, word)
+		}
+	}
+	return result
+}
+
+// return the distinct runs of gramLength runes in word
+func grams(word string) []string {
+	runes := []rune(word)
+	var result []string
+	seen := make(map[string]struct{})
+	for i := 0; i+gramLength <= len(runes); i++ {
+		gram := string(runes[i : i+gramLength])
+		if _, exists := seen[gram]; !exists {
+			seen[gram] = struct{}{}
+			result = append(result, gram)
+		}
+	}
+	return result
+}
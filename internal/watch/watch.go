@@ -0,0 +1,82 @@
+package watch
+
+import (
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// Watcher reports files and directories, below a root directory, that were created, written, removed or renamed.
+// Changes to the same path are debounced, so a burst of events for a path results in a single call to onChange.
+type Watcher struct {
+	mayUseDirectory func(fullPath string, fileInfo fs.FileInfo) bool
+	onChange        func(fullPath string)
+	debounce        time.Duration
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+	closed bool
+
+	platform
+}
+
+// New starts watching root, and every directory below it for which mayUseDirectory returns true.
+// onChange is called with the full path of a changed file or directory, once no further events arrived for that path
+// for the debounce duration. It is called from its own goroutine, and may be called concurrently for different paths.
+func New(root string, mayUseDirectory func(fullPath string, fileInfo fs.FileInfo) bool, debounce time.Duration, onChange func(fullPath string)) (*Watcher, error) {
+	w := &Watcher{
+		mayUseDirectory: mayUseDirectory,
+		onChange:        onChange,
+		debounce:        debounce,
+		timers:          make(map[string]*time.Timer),
+	}
+
+	if err := w.start(root); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Close stops watching; pending changes are dropped
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	w.closed = true
+	for fullPath, timer := range w.timers {
+		timer.Stop()
+		delete(w.timers, fullPath)
+	}
+	w.mu.Unlock()
+
+	return w.stop()
+}
+
+func (w *Watcher) changed(fullPath string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	if timer, exists := w.timers[fullPath]; exists {
+		timer.Reset(w.debounce)
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(w.debounce, func() {
+		w.mu.Lock()
+		// the timer may have been reset while firing, in which case a newer timer could be registered already
+		if w.timers[fullPath] == timer {
+			delete(w.timers, fullPath)
+		}
+		closed := w.closed
+		w.mu.Unlock()
+
+		if !closed {
+			w.onChange(fullPath)
+		}
+	})
+	w.timers[fullPath] = timer
+}
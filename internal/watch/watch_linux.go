@@ -0,0 +1,131 @@
+//go:build linux
+
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const watchMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_ONLYDIR
+
+// platform holds the inotify state
+type platform struct {
+	root        string
+	inotifyFd   int
+	inotifyFile *os.File
+	// guarded by Watcher.mu
+	directories map[int32]string
+}
+
+func (w *Watcher) start(root string) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+
+	w.root = root
+	w.inotifyFd = fd
+	// a non blocking fd is handled by the runtime poller, so that a pending Read returns once the file is closed
+	w.inotifyFile = os.NewFile(uintptr(fd), "inotify")
+	w.directories = make(map[int32]string)
+
+	if err := w.addDirectory(root); err != nil {
+		w.inotifyFile.Close()
+		return err
+	}
+
+	go w.readEvents()
+
+	return nil
+}
+
+func (w *Watcher) stop() error {
+	return w.inotifyFile.Close()
+}
+
+// watch directory, and the directories below it, for changes
+func (w *Watcher) addDirectory(directory string) error {
+	wd, err := syscall.InotifyAddWatch(w.inotifyFd, directory, watchMask)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.directories[int32(wd)] = directory
+	w.mu.Unlock()
+
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		fullPath := filepath.Join(directory, file.Name())
+		if file.IsDir() && w.mayUseDirectory(fullPath, file) {
+			if err := w.addDirectory(fullPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *Watcher) readEvents() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.inotifyFile.Read(buf)
+		if err != nil {
+			// the file is closed once the watcher is closed
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			name := strings.TrimRight(string(nameBytes), "\x00")
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			w.handleEvent(event.Wd, event.Mask, name)
+		}
+	}
+}
+
+func (w *Watcher) handleEvent(wd int32, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		// events were lost, so everything may have changed
+		w.changed(w.root)
+		return
+	}
+
+	w.mu.Lock()
+	directory, exists := w.directories[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.directories, wd)
+	}
+	w.mu.Unlock()
+
+	if !exists || name == "" {
+		// events about the watched directory itself are reported through its parent
+		return
+	}
+
+	fullPath := filepath.Join(directory, name)
+
+	if mask&syscall.IN_ISDIR != 0 && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		fileInfo, err := os.Lstat(fullPath)
+		if err != nil || !w.mayUseDirectory(fullPath, fileInfo) {
+			return
+		}
+		// files created in the directory before it is watched, are picked up by reporting the directory itself
+		w.addDirectory(fullPath)
+	}
+
+	w.changed(fullPath)
+}
@@ -0,0 +1,52 @@
+//go:build linux
+
+package watch
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatcher_DebouncesChanges(t *testing.T) {
+	root := t.TempDir()
+	assert.Nil(t, os.Mkdir(filepath.Join(root, "src"), 0755))
+	assert.Nil(t, os.Mkdir(filepath.Join(root, "ignored"), 0755))
+
+	var mu sync.Mutex
+	changes := make(map[string]int)
+	mayUseDirectory := func(fullPath string, fileInfo fs.FileInfo) bool {
+		return fullPath != filepath.Join(root, "ignored")
+	}
+	w, err := New(root, mayUseDirectory, 100*time.Millisecond, func(fullPath string) {
+		mu.Lock()
+		changes[fullPath]++
+		mu.Unlock()
+	})
+	assert.Nil(t, err)
+	defer w.Close()
+
+	file := filepath.Join(root, "src", "a.txt")
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, os.WriteFile(file, []byte("content"), 0644))
+	}
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "ignored", "b.txt"), []byte("content"), 0644))
+	assert.Nil(t, os.Mkdir(filepath.Join(root, "new"), 0755))
+	time.Sleep(50 * time.Millisecond)
+	newFile := filepath.Join(root, "new", "c.txt")
+	assert.Nil(t, os.WriteFile(newFile, []byte("content"), 0644))
+
+	time.Sleep(400 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, changes[file])
+	assert.Equal(t, 1, changes[filepath.Join(root, "new")])
+	assert.Equal(t, 1, changes[newFile])
+	_, ignoredChanged := changes[filepath.Join(root, "ignored", "b.txt")]
+	assert.False(t, ignoredChanged)
+}
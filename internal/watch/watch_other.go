@@ -0,0 +1,17 @@
+//go:build !linux
+
+package watch
+
+import "errors"
+
+var ErrUnsupported = errors.New("watching for changes is only supported on linux")
+
+type platform struct{}
+
+func (w *Watcher) start(root string) error {
+	return ErrUnsupported
+}
+
+func (w *Watcher) stop() error {
+	return nil
+}